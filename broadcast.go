@@ -0,0 +1,114 @@
+package streamcast
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// NewBroadcastUdpTx sends to the directed broadcast address of every IPv4
+// subnet on ifaces, or on all broadcast capable interfaces if none are
+// given. See BroadcastAddrs.
+func NewBroadcastUdpTx(port int, copiesToSend int, ifaces ...*net.Interface) (s *UdpTx, err error) {
+	ips, err := BroadcastAddrs(ifaces...)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("No broadcast addresses found")
+	}
+	s, err = NewUdpTx(ips[0].String(), port, copiesToSend)
+	if err != nil {
+		return nil, err
+	}
+	s.addrs = nil
+	for _, ip := range ips {
+		s.addrs = append(s.addrs, &net.UDPAddr{IP: ip, Port: port})
+	}
+	if err = s.SetBroadcast(true); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return
+}
+
+// SetBroadcast enables SO_BROADCAST, which is required to send to a
+// broadcast address such as 255.255.255.255 or a subnet broadcast.
+func (s *UdpTx) SetBroadcast(enabled bool) error {
+	rc, err := s.rawConn()
+	if err != nil {
+		return err
+	}
+	return setBroadcast(rc, enabled)
+}
+
+// BroadcastAddrs returns the directed broadcast address of every IPv4
+// subnet on ifaces, or on all up, broadcast capable interfaces if none are
+// given. Point-to-point subnets (/31 and /32) have none.
+func BroadcastAddrs(ifaces ...*net.Interface) (ips []net.IP, err error) {
+	if len(ifaces) == 0 {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+		for i := range all {
+			if all[i].Flags&net.FlagUp != 0 && all[i].Flags&net.FlagBroadcast != 0 {
+				ifaces = append(ifaces, &all[i])
+			}
+		}
+	}
+	for _, ifi := range ifaces {
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if broadcast := directedBroadcast(ipNet); broadcast != nil {
+				ips = append(ips, broadcast)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// The broadcast address of an IPv4 subnet, nil if it has none.
+func directedBroadcast(ipNet *net.IPNet) net.IP {
+	ip := ipNet.IP.To4()
+	if ip == nil {
+		return nil
+	}
+	if ones, bits := ipNet.Mask.Size(); bits != 8*net.IPv4len || ones > 30 {
+		return nil
+	}
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range broadcast {
+		broadcast[i] = ip[i] | ^ipNet.Mask[i]
+	}
+	return broadcast
+}
+
+// NewBroadcastRxConn receives broadcast frames on port. Broadcasts are only
+// delivered to sockets bound to the wildcard address, so the socket binds
+// all interfaces, shared with other receivers on the host.
+func NewBroadcastRxConn(port int) (c *UdpRxConn, err error) {
+	c, err = NewUdpRxConn(net.IPv4zero.String(), port)
+	if err != nil {
+		return nil, err
+	}
+	c.broadcast = true
+	return
+}
+
+// Must be called with udpRxConn.mu held.
+func (udpRxConn *UdpRxConn) listenBroadcast() (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: reuseAddr}
+	pc, err := lc.ListenPacket(context.Background(), "udp4", udpRxConn.addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return pc.(*net.UDPConn), nil
+}
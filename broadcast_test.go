@@ -0,0 +1,57 @@
+package streamcast
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDirectedBroadcast(t *testing.T) {
+	for cidr, expected := range map[string]string{
+		"192.0.2.2/24":  "192.0.2.255",
+		"10.1.2.3/20":   "10.1.15.255",
+		"10.1.2.3/31":   "<nil>",
+		"fd00::2/64":    "<nil>",
+		"172.16.0.1/30": "172.16.0.3",
+	} {
+		ip, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		if actual := directedBroadcast(ipNet).String(); actual != expected {
+			t.Errorf("Broadcast of %s is %s, expected %s", cidr, actual, expected)
+		}
+	}
+}
+
+func TestBroadcastRoundTrip(t *testing.T) {
+	ips, err := BroadcastAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) == 0 {
+		t.Skip("No broadcast capable interface")
+	}
+
+	conn, err := NewBroadcastRxConn(8898)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx, err := InitRxIsochronous(conn, time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+
+	tx, err := NewBroadcastUdpTx(8898, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	f := makeFrame(1)
+	if err = tx.WriteFrame(&f); err != nil {
+		t.Fatal(err)
+	}
+	expectFrame(t, rx, 1)
+}
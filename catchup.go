@@ -0,0 +1,83 @@
+package streamcast
+
+import (
+	"log"
+	"time"
+)
+
+// DiscardableFunc reports whether a frame may be dropped to reduce latency.
+// It is called with the receiver locked and must not call back into it.
+type DiscardableFunc func(f *Frame) bool
+
+// SetCatchUp enables dropping frames when the buffered latency exceeds the
+// target by more than threshold, for instance after a stall followed by a
+// burst. The target is the pre-roll if one is set, otherwise the buffer.
+// Frames are dropped from the head of the cache while discardable returns
+// true (nil treats every frame as discardable) and the timeline is moved
+// forward so the remaining frames are released on schedule. A zero
+// threshold disables catch-up. Must be called before the first Read.
+func (r *RxIsochronous) SetCatchUp(threshold time.Duration, discardable DiscardableFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.catchUpThreshold = threshold
+	r.discardable = discardable
+	// The cache must be able to hold the excess for us to see it.
+	r.resizeCache()
+}
+
+// SkippedForLatency returns the number of frames dropped by catch-up.
+func (r *RxIsochronous) SkippedForLatency() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats.SkippedForLatency
+}
+
+func (r *RxIsochronous) targetLatency() time.Duration {
+	if r.preroll > 0 {
+		return r.preroll
+	}
+	if r.prerollDepth > 0 {
+		return time.Duration(r.prerollDepth) * r.framePeriod
+	}
+	return r.buffer
+}
+
+// Drop frames from the head of the cache until the buffered latency is back
+// within threshold of the target.
+func (r *RxIsochronous) catchUp() {
+	if r.catchUpThreshold == 0 {
+		return
+	}
+	newest := r.cache.Newest()
+	if newest == nil {
+		return
+	}
+	newestRelease := r.releaseAt(newest.FrameId, newest)
+	limit := r.targetLatency() + r.catchUpThreshold
+
+	before := r.releaseAt(r.nextFrameId, r.cache.Peek(r.nextFrameId))
+	release := before
+	var skipped uint64
+	for r.nextFrameId != newest.FrameId && newestRelease.Sub(release) > limit {
+		f := r.cache.Peek(r.nextFrameId)
+		if f != nil {
+			if r.discardable != nil && !r.discardable(f) {
+				break
+			}
+			r.cache.Get(r.nextFrameId)
+		}
+		r.nextFrameId++
+		skipped++
+		release = r.releaseAt(r.nextFrameId, r.cache.Peek(r.nextFrameId))
+	}
+	if skipped == 0 {
+		return
+	}
+	if debug {
+		log.Printf("Catch-up skipped %d frames to %d", skipped, r.nextFrameId)
+	}
+	r.stats.SkippedForLatency += skipped
+	shift := before.Sub(release)
+	r.baseTime = r.baseTime.Add(shift)
+	r.lastRelease = r.lastRelease.Add(shift)
+}
@@ -2,44 +2,80 @@ package streamcast
 
 import (
 	"bufio"
+	"io"
 	"net"
+	"sync"
+	"time"
 )
 
+// Frames queued for a client before further ones are dropped.
+const clientQueue = 64
+
 type Client struct {
-	incoming chan []byte
 	outgoing chan []byte
-	reader   *bufio.Reader
 	writer   *bufio.Writer
 	conn     net.Conn
+	// How long a write may stall before the client is dropped, zero for
+	// no limit.
+	timeout time.Duration
+	// Closed once the client is disconnected.
+	done chan struct{}
+	once sync.Once
 }
 
 func NewClient(connection net.Conn) *Client {
+	return newClient(connection, 0)
+}
+
+func newClient(connection net.Conn, timeout time.Duration) *Client {
 	writer := bufio.NewWriter(connection)
-	reader := bufio.NewReader(connection)
 
 	client := &Client{
-		incoming: make(chan []byte),
-		outgoing: make(chan []byte),
-		reader:   reader,
+		outgoing: make(chan []byte, clientQueue),
 		writer:   writer,
+		conn:     connection,
+		timeout:  timeout,
+		done:     make(chan struct{}),
 	}
 
 	client.Listen()
 	return client
 }
 
-func (client *Client) Read() {
-	for {
-		// todo we could use this to have any client broadcast to all its peers.
-		line, _ := client.reader.ReadBytes(100)
-		client.incoming <- line
+// Queue data, reporting false if the queue is full.
+func (client *Client) send(data []byte) bool {
+	select {
+	case client.outgoing <- data:
+		return true
+	case <-client.done:
+		return true
+	default:
+		return false
 	}
 }
 
+// Read watches for the client hanging up. Subscribers have nothing to say,
+// so anything they send is discarded.
+func (client *Client) Read() {
+	io.Copy(io.Discard, client.conn)
+	client.Close()
+}
+
 func (client *Client) Write() {
-	for data := range client.outgoing {
-		client.writer.Write(data)
-		client.writer.Flush()
+	for {
+		select {
+		case data := <-client.outgoing:
+			if client.timeout > 0 {
+				client.conn.SetWriteDeadline(time.Now().Add(client.timeout))
+			}
+			client.writer.Write(data)
+			if err := client.writer.Flush(); err != nil {
+				client.Close()
+				return
+			}
+		case <-client.done:
+			return
+		}
 	}
 }
 
@@ -49,5 +85,8 @@ func (client *Client) Listen() {
 }
 
 func (client *Client) Close() {
-	client.conn.Close()
+	client.once.Do(func() {
+		close(client.done)
+		client.conn.Close()
+	})
 }
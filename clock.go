@@ -0,0 +1,172 @@
+package streamcast
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used for isochronous timing. It allows
+// receivers and transmitters to be driven by a FakeClock in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer mirrors the subset of *time.Timer used by streamcast.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Stop t if it was started.
+func stopTimer(t Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// RealClock is the default Clock, backed by the time package.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t *realTimer) C() <-chan time.Time        { return t.t.C }
+func (t *realTimer) Stop() bool                 { return t.t.Stop() }
+func (t *realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// FakeClock is a manually advanced Clock. Time only moves when Advance is
+// called, which makes deadline behavior deterministic.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+func NewFakeClock(start time.Time) (c *FakeClock) {
+	c = new(FakeClock)
+	c.now = start
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	c.schedule(t, d)
+	return t
+}
+
+// Advance moves the clock forward by d, firing every timer that expires.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+// Set moves the clock to t, firing every timer that expires.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+	c.fire()
+}
+
+// BlockUntil waits until at least n timers are pending on the clock.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// Waiters returns the number of pending timers.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Must be called with c.mu held.
+func (c *FakeClock) schedule(t *fakeTimer, d time.Duration) {
+	t.when = c.now.Add(d)
+	if d <= 0 {
+		t.send(c.now)
+		return
+	}
+	c.waiters = append(c.waiters, t)
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].when.Before(c.waiters[j].when)
+	})
+	c.cond.Broadcast()
+}
+
+// Must be called with c.mu held.
+func (c *FakeClock) unschedule(t *fakeTimer) bool {
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Must be called with c.mu held.
+func (c *FakeClock) fire() {
+	for len(c.waiters) > 0 && !c.waiters[0].when.After(c.now) {
+		t := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		t.send(c.now)
+	}
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	c     chan time.Time
+	when  time.Time
+}
+
+func (t *fakeTimer) send(now time.Time) {
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.unschedule(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.unschedule(t)
+	t.clock.schedule(t, d)
+	return active
+}
@@ -8,7 +8,7 @@ import (
 )
 
 func main() {
-	rx, err := streamcast.NewRxIsochronous(os.Args[1], os.Args[2], 1337, 100 * time.Millisecond, 5 * time.Millisecond)
+	rx, err := streamcast.NewRxIsochronous(os.Args[1], os.Args[2], 1337, 0, 5 * time.Millisecond)
 	if err != nil {
 		panic(err)
 	}
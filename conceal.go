@@ -0,0 +1,68 @@
+package streamcast
+
+// ConcealmentPolicy selects what RxIsochronous.Read returns when a frame
+// misses its deadline.
+type ConcealmentPolicy int
+
+const (
+	// Return an rx timeout error and reset timing (the default).
+	ConcealError ConcealmentPolicy = iota
+	// Return a copy of the last delivered frame.
+	ConcealRepeat
+	// Return a zeroed frame the size of the last delivered frame.
+	ConcealSilence
+	// Return the frame produced by the ConcealFunc.
+	ConcealCallback
+)
+
+// ConcealFunc produces a replacement for a missing frame. last is the most
+// recently delivered frame, or nil if there is none. It is called with the
+// receiver locked and must not call back into it.
+type ConcealFunc func(frameId uint32, last *Frame) *Frame
+
+// SetConcealment selects the policy applied when a frame misses its
+// deadline. With any policy other than ConcealError the missing frame is
+// replaced by a synthesized one and the timeline keeps running.
+func (r *RxIsochronous) SetConcealment(policy ConcealmentPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.concealment = policy
+}
+
+// SetConcealFunc installs fn and selects ConcealCallback.
+func (r *RxIsochronous) SetConcealFunc(fn ConcealFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.concealFunc = fn
+	r.concealment = ConcealCallback
+}
+
+// Build a stand-in for frameId according to the concealment policy. A nil
+// return means the policy had nothing to offer.
+func (r *RxIsochronous) conceal(frameId uint32) (f *Frame) {
+	switch r.concealment {
+	case ConcealRepeat:
+		f = new(Frame)
+		if r.lastFrame != nil {
+			f.Metadata = append([]byte(nil), r.lastFrame.Metadata...)
+			f.Data = append([]byte(nil), r.lastFrame.Data...)
+		}
+	case ConcealSilence:
+		f = new(Frame)
+		if r.lastFrame != nil {
+			f.Data = make([]byte, len(r.lastFrame.Data))
+		}
+	case ConcealCallback:
+		if r.concealFunc == nil {
+			return nil
+		}
+		if f = r.concealFunc(frameId, r.lastFrame); f == nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	f.FrameId = frameId
+	f.Synthesized = true
+	return f
+}
@@ -0,0 +1,141 @@
+package streamcast
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentQueriesAndReconfiguration(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.OnStateChange(func(from RxState, to RxState) {
+		// Callbacks run unlocked and may query the receiver.
+		rx.State()
+	})
+
+	const frames = 200
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			rx.State()
+			rx.NextDeadlineFromNow()
+			rx.FramePeriod()
+			rx.SkippedForLatency()
+			rx.SetConcealment(ConcealRepeat)
+			rx.SetResync(ResyncSkip, 4)
+			rx.SetLateDelivery(LateChannel)
+			rx.Late()
+		}
+	}()
+
+	go func() {
+		for i := uint32(1); i <= frames; i++ {
+			conn.push(i)
+		}
+	}()
+	for i := uint32(1); i <= frames; i++ {
+		expectFrame(t, rx, i)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestCloseInterruptsRead(t *testing.T) {
+	rx, err := NewRxIsochronous("udp", "127.0.0.1", 8888, time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error)
+	go func() {
+		_, err := rx.Read()
+		result <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	rx.Close()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Fatalf("Read succeeded on a closed connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Close did not interrupt Read")
+	}
+}
+
+func TestFrameCacheConcurrent(t *testing.T) {
+	fc := NewFrameCache(16)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := uint32(0); i < 1000; i++ {
+			f := makeFrame(i)
+			fc.Put(&f)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := uint32(0); i < 1000; i++ {
+			fc.Len()
+			fc.Oldest()
+			fc.Peek(i / 2)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestFrameCacheLookup(t *testing.T) {
+	fc := NewFrameCache(16)
+	for _, id := range []uint32{1, 2} {
+		f := makeFrame(id)
+		fc.Put(&f)
+	}
+	if fc.Lookup(3) != nil || fc.Lookup(2).FrameId != 2 {
+		t.Fatalf("Lookup found the wrong frames")
+	}
+	if f := fc.Get(1); f == nil || fc.Len() != 1 {
+		t.Fatalf("Lookup disturbed the cache")
+	}
+}
+
+func TestReconfigureKeepsBufferedFrames(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetPreroll(10*time.Millisecond, 0)
+	done := make(chan error)
+	go func() {
+		_, err := rx.Read()
+		done <- err
+	}()
+	conn.push(1, 2, 3)
+	waitForReceived(t, rx, 3)
+
+	rx.SetCatchUp(time.Hour, nil)
+	rx.SetVariableFrameRate(false)
+	rx.mu.Lock()
+	n := rx.cache.Len()
+	rx.mu.Unlock()
+	if n != 3 {
+		t.Fatalf("%d frames left after reconfiguration, expected 3", n)
+	}
+
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint32{2, 3} {
+		go func() {
+			clock.BlockUntil(1)
+			clock.Advance(time.Millisecond)
+		}()
+		expectFrame(t, rx, id)
+	}
+}
@@ -0,0 +1,61 @@
+package streamcast
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A non-zero deadline in the past, used to wake blocked I/O.
+var aLongTimeAgo = time.Time{}.Add(1)
+
+// contextDeadline applies connection deadlines on behalf of an operation
+// bound to a context. Deadlines are capped at the context deadline, and
+// once the context is done every deadline is forced into the past so
+// blocked I/O returns.
+type contextDeadline struct {
+	mu   sync.Mutex
+	ctx  context.Context
+	set  func(t time.Time) error
+	done bool
+	stop func() bool
+	// Closed once the AfterFunc callback has run.
+	fired chan struct{}
+}
+
+func watchContext(ctx context.Context, set func(t time.Time) error) (w *contextDeadline) {
+	w = &contextDeadline{ctx: ctx, set: set, fired: make(chan struct{})}
+	w.stop = context.AfterFunc(ctx, func() {
+		defer close(w.fired)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.done = true
+		w.set(aLongTimeAgo)
+	})
+	return w
+}
+
+func (w *contextDeadline) SetDeadline(t time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return w.set(aLongTimeAgo)
+	}
+	if d, ok := w.ctx.Deadline(); ok && (t.IsZero() || d.Before(t)) {
+		t = d
+	}
+	return w.set(t)
+}
+
+// Stop watching the context. Returns ctx.Err() if the context ended the
+// operation, so callers can report it in place of the I/O error. Must be
+// called once.
+func (w *contextDeadline) Close() error {
+	if !w.stop() {
+		// The callback already started. Let it finish, or it could push
+		// the deadline of the next operation on the connection into the
+		// past.
+		<-w.fired
+	}
+	return w.ctx.Err()
+}
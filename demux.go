@@ -0,0 +1,350 @@
+package streamcast
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	demuxPacketQueue   = 64
+	defaultIdleTimeout = 5 * time.Second
+	minIdleTimeout     = 10 * time.Millisecond
+)
+
+// SenderKey identifies one stream received by an RxDemux.
+type SenderKey struct {
+	// Source address as reported by the connection.
+	Addr string
+	// Session id advertised by the sender, zero if none.
+	SessionId uint32
+}
+
+// NewSenderFunc is called with the receiver created for a new sender,
+// before any of its frames are queued. Configure rx here and start reading
+// it on another goroutine: the callback runs on the demux read loop, so
+// every sender stalls until it returns.
+type NewSenderFunc func(key SenderKey, rx *RxIsochronous)
+
+// SenderGoneFunc is called once a sender has been idle for the idle
+// timeout. Its receiver has been closed.
+type SenderGoneFunc func(key SenderKey)
+
+// RxDemux reads a connection shared by several senders and feeds each
+// sender's frames to its own RxIsochronous, so frame ids of different
+// senders never mix. Senders are keyed by source address and session id.
+type RxDemux struct {
+	mu          sync.Mutex
+	conn        SourceRxConn
+	clock       Clock
+	framePeriod time.Duration
+	buffer      time.Duration
+	idleTimeout time.Duration
+	senders     map[SenderKey]*demuxSender
+	onNew       NewSenderFunc
+	onGone      SenderGoneFunc
+	cancel      context.CancelFunc
+	done        chan struct{}
+	once        sync.Once
+	err         error
+}
+
+type demuxSender struct {
+	conn     *demuxConn
+	rx       *RxIsochronous
+	lastSeen time.Time
+}
+
+// Each sender gets a receiver built with framePeriod and buffer, as with
+// InitRxIsochronous.
+func NewRxDemux(conn SourceRxConn, framePeriod time.Duration, buffer time.Duration) (d *RxDemux, err error) {
+	d = new(RxDemux)
+	d.conn = conn
+	d.clock = RealClock
+	d.framePeriod = framePeriod
+	d.buffer = buffer
+	d.idleTimeout = defaultIdleTimeout
+	d.senders = make(map[SenderKey]*demuxSender)
+	d.done = make(chan struct{})
+	if err = conn.Reset(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// SetClock replaces the clock used for idle detection and by the
+// per-sender receivers. The connection must follow the same clock.
+func (d *RxDemux) SetClock(c Clock) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock = c
+}
+
+// SetIdleTimeout sets how long a sender may stay silent before it is
+// considered gone. Timeouts under 10ms are raised to 10ms.
+func (d *RxDemux) SetIdleTimeout(t time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.idleTimeout = max(t, minIdleTimeout)
+}
+
+// OnNewSender registers the callback for new senders. Must be called
+// before Start.
+func (d *RxDemux) OnNewSender(fn NewSenderFunc) {
+	d.onNew = fn
+}
+
+// OnSenderGone registers the callback for idle senders. Must be called
+// before Start.
+func (d *RxDemux) OnSenderGone(fn SenderGoneFunc) {
+	d.onGone = fn
+}
+
+// Senders returns the keys of the active senders.
+func (d *RxDemux) Senders() (keys []SenderKey) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key := range d.senders {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Done is closed once the read loop has exited, either after Stop or
+// because reading the connection failed. Err then holds the failure.
+func (d *RxDemux) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the error that ended the read loop, nil if it was stopped or
+// is still running.
+func (d *RxDemux) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+func (d *RxDemux) Start() {
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	go d.run(ctx)
+}
+
+// Stop ends the read loop, waits for it to exit and closes every sender's
+// receiver. The shared connection stays open.
+func (d *RxDemux) Stop() {
+	d.once.Do(func() {
+		if d.cancel != nil {
+			d.cancel()
+			<-d.done
+		}
+		d.mu.Lock()
+		senders := d.senders
+		d.senders = make(map[SenderKey]*demuxSender)
+		d.mu.Unlock()
+		for key, s := range senders {
+			d.gone(key, s)
+		}
+	})
+}
+
+func (d *RxDemux) Close() {
+	d.Stop()
+	d.conn.Close()
+}
+
+func (d *RxDemux) run(ctx context.Context) {
+	defer close(d.done)
+	deadline := watchContext(ctx, d.conn.SetDeadline)
+	defer deadline.Close()
+
+	var b [MAX_FRAME_LENGTH]byte
+	for {
+		d.mu.Lock()
+		sweep := d.clock.Now().Add(d.idleTimeout / 4)
+		d.mu.Unlock()
+		deadline.SetDeadline(sweep)
+
+		n, addr, err := d.conn.ReadFrom(b[:])
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if neterr, ok := err.(net.Error); ok && neterr.Timeout() || errors.Is(err, ErrReconnected) {
+				d.sweep()
+				continue
+			}
+			// The connection is closed or broken, reading again would
+			// only fail again.
+			if debug {
+				log.Printf("Demux read error: %v", err)
+			}
+			if !errors.Is(err, net.ErrClosed) {
+				d.mu.Lock()
+				d.err = err
+				d.mu.Unlock()
+			}
+			return
+		}
+
+		var f Frame
+		if err = f.Read(b[:n]); err != nil {
+			if debug {
+				log.Printf("Demux dropped invalid packet from %v: %v", addr, err)
+			}
+			continue
+		}
+		key := SenderKey{SessionId: f.SessionId}
+		if addr != nil {
+			key.Addr = addr.String()
+		}
+		d.sender(key, addr).conn.push(append([]byte(nil), b[:n]...))
+		d.sweep()
+	}
+}
+
+// Find the sender for key, creating it on first sight.
+func (d *RxDemux) sender(key SenderKey, addr net.Addr) *demuxSender {
+	d.mu.Lock()
+	s := d.senders[key]
+	if s != nil {
+		s.lastSeen = d.clock.Now()
+		d.mu.Unlock()
+		return s
+	}
+	s = new(demuxSender)
+	s.conn = newDemuxConn(d.clock, addr)
+	// A demuxConn cannot fail to reset.
+	s.rx, _ = InitRxIsochronous(s.conn, d.framePeriod, d.buffer)
+	s.rx.SetClock(d.clock)
+	s.lastSeen = d.clock.Now()
+	d.senders[key] = s
+	d.mu.Unlock()
+
+	if debug {
+		log.Printf("New sender %s session %d", key.Addr, key.SessionId)
+	}
+	if d.onNew != nil {
+		d.onNew(key, s.rx)
+	}
+	return s
+}
+
+// Drop senders that have been idle for the idle timeout.
+func (d *RxDemux) sweep() {
+	gone := make(map[SenderKey]*demuxSender)
+	d.mu.Lock()
+	now := d.clock.Now()
+	for key, s := range d.senders {
+		if now.Sub(s.lastSeen) >= d.idleTimeout {
+			gone[key] = s
+			delete(d.senders, key)
+		}
+	}
+	d.mu.Unlock()
+	for key, s := range gone {
+		d.gone(key, s)
+	}
+}
+
+func (d *RxDemux) gone(key SenderKey, s *demuxSender) {
+	if debug {
+		log.Printf("Sender %s session %d gone", key.Addr, key.SessionId)
+	}
+	s.rx.Close()
+	if d.onGone != nil {
+		d.onGone(key)
+	}
+}
+
+// demuxConn is the RxConn of one demultiplexed sender. Packets are pushed by
+// the RxDemux read loop and deadlines follow the demux clock.
+type demuxConn struct {
+	clock    Clock
+	source   net.Addr
+	packets  chan []byte
+	changed  chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func newDemuxConn(clock Clock, source net.Addr) *demuxConn {
+	return &demuxConn{
+		clock:   clock,
+		source:  source,
+		packets: make(chan []byte, demuxPacketQueue),
+		changed: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Drops the packet if the sender's reader has fallen behind.
+func (c *demuxConn) push(p []byte) {
+	select {
+	case c.packets <- p:
+	default:
+		if debug {
+			log.Printf("Demux queue full for %v, dropping packet", c.source)
+		}
+	}
+}
+
+func (c *demuxConn) Reset() error { return nil }
+
+func (c *demuxConn) Close() {
+	c.once.Do(func() { close(c.closed) })
+}
+
+// Like a socket, changing the deadline affects a Read in progress.
+func (c *demuxConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *demuxConn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadFrom(b)
+	return n, err
+}
+
+func (c *demuxConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		deadline := c.deadline
+		c.mu.Unlock()
+
+		var timer Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := deadline.Sub(c.clock.Now())
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = c.clock.NewTimer(d)
+			timeout = timer.C()
+		}
+		select {
+		case p := <-c.packets:
+			stopTimer(timer)
+			return copy(b, p), c.source, nil
+		case <-c.closed:
+			stopTimer(timer)
+			return 0, nil, net.ErrClosed
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-c.changed:
+			stopTimer(timer)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package streamcast
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingConn is a pipeRxConn reporting a fixed source and counting reads.
+type countingConn struct {
+	*pipeRxConn
+	reads atomic.Int64
+}
+
+func (c *countingConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.reads.Add(1)
+	n, err := c.Read(b)
+	return n, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}, err
+}
+
+func TestDemuxPerSender(t *testing.T) {
+	conn, err := NewUdpRxConn("127.0.0.1", 8893)
+	if err != nil {
+		t.Fatal(err)
+	}
+	demux, err := NewRxDemux(conn, time.Millisecond, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer demux.Close()
+
+	type sender struct {
+		key SenderKey
+		rx  *RxIsochronous
+	}
+	receivers := make(chan sender, 3)
+	gone := make(chan SenderKey, 3)
+	demux.OnNewSender(func(key SenderKey, rx *RxIsochronous) {
+		receivers <- sender{key, rx}
+	})
+	demux.OnSenderGone(func(key SenderKey) { gone <- key })
+	demux.SetIdleTimeout(100 * time.Millisecond)
+	demux.Start()
+
+	// Three streams with colliding frame ids, two of them from one address.
+	senders := []struct {
+		from    string
+		session uint32
+		payload uint32
+	}{
+		{"127.0.0.1:8894", 0, 100},
+		{"127.0.0.1:8894", 7, 200},
+		{"127.0.0.1:8895", 0, 300},
+	}
+	for id := uint32(1); id <= 2; id++ {
+		for _, s := range senders {
+			f := makeFrame(s.payload + id)
+			f.FrameId = id
+			f.SessionId = s.session
+			sendFrameFrom(t, s.from, 8893, &f)
+		}
+	}
+
+	var detected []*RxIsochronous
+	for range senders {
+		var r sender
+		select {
+		case r = <-receivers:
+		case <-time.After(time.Second):
+			t.Fatalf("Sender not detected")
+		}
+		key, rx := r.key, r.rx
+		detected = append(detected, rx)
+		var base uint32
+		for _, s := range senders {
+			if s.from == key.Addr && s.session == key.SessionId {
+				base = s.payload
+			}
+		}
+		if base == 0 {
+			t.Fatalf("Unexpected sender %+v", key)
+		}
+		expectFrame(t, rx, base+1)
+		expectFrame(t, rx, base+2)
+	}
+
+	for range senders {
+		select {
+		case <-gone:
+		case <-time.After(time.Second):
+			t.Fatalf("Idle sender not removed")
+		}
+	}
+	if n := len(demux.Senders()); n != 0 {
+		t.Fatalf("%d senders left", n)
+	}
+	// The missed frame 3 may be reported before the closed connection.
+	for _, rx := range detected {
+		_, err := rx.Read()
+		if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+			_, err = rx.Read()
+		}
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("Expected closed receiver, got %v", err)
+		}
+	}
+}
+
+func TestDemuxReadLoopDoesNotSpin(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	conn := &countingConn{pipeRxConn: newPipeRxConn(clock)}
+	demux, err := NewRxDemux(conn, time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	demux.SetClock(clock)
+	demux.SetIdleTimeout(0)
+	demux.Start()
+	defer demux.Stop()
+
+	// A zero idle timeout would make every read deadline already expired.
+	clock.BlockUntil(1)
+	time.Sleep(20 * time.Millisecond)
+	if n := conn.reads.Load(); n != 1 {
+		t.Fatalf("%d reads without time passing", n)
+	}
+
+	conn.errs <- io.EOF
+	select {
+	case <-demux.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Read loop still running after EOF")
+	}
+	if demux.Err() != io.EOF {
+		t.Fatalf("Expected EOF, got %v", demux.Err())
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"net"
+	"time"
 )
 
 type Frame struct {
@@ -11,10 +13,35 @@ type Frame struct {
 	FrameId  uint32
 	Metadata []byte
 	Data     []byte
+
+	// Sender media timestamp, zero if the sender did not provide one.
+	Timestamp time.Time
+	// Nominal frame period advertised by the sender, zero if absent.
+	Period time.Duration
+	// Sender chosen stream identifier, zero if absent. See RxDemux.
+	SessionId uint32
+
+	// Address of the sender, nil if the connection does not report it.
+	Source net.Addr
+
+	// Set on frames produced by loss concealment rather than received.
+	Synthesized bool
+	// Set on frames that arrived after their playout deadline, by Lateness.
+	Late     bool
+	Lateness time.Duration
 }
 
 const MAX_FRAME_LENGTH = 1400
 
+// Optional header extensions follow the data as type/length/value triples.
+// Receivers skip types they do not know, so peers of different versions
+// interoperate. A zero type ends the list.
+const (
+	extTimestamp uint8 = 1
+	extPeriod    uint8 = 2
+	extSession   uint8 = 3
+)
+
 func (f *Frame) Read(b []byte) (err error) {
 	var length uint16
 	if len(b) > MAX_FRAME_LENGTH {
@@ -33,16 +60,61 @@ func (f *Frame) Read(b []byte) (err error) {
 		return err
 	}
 	f.Data = buf.Next(int(length))
+	f.readExtensions(buf)
 	return
 }
 
+func (f *Frame) readExtensions(buf *bytes.Buffer) {
+	for buf.Len() >= 2 {
+		header := buf.Next(2)
+		if header[0] == 0 {
+			return
+		}
+		value := buf.Next(int(header[1]))
+		if len(value) < int(header[1]) {
+			return
+		}
+		switch header[0] {
+		case extTimestamp:
+			if len(value) == 8 {
+				f.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+			}
+		case extPeriod:
+			if len(value) == 8 {
+				f.Period = time.Duration(binary.BigEndian.Uint64(value))
+			}
+		case extSession:
+			if len(value) == 4 {
+				f.SessionId = binary.BigEndian.Uint32(value)
+			}
+		}
+	}
+}
+
+func (f *Frame) extensions() (b []byte) {
+	if !f.Timestamp.IsZero() {
+		b = append(b, extTimestamp, 8)
+		b = binary.BigEndian.AppendUint64(b, uint64(f.Timestamp.UnixNano()))
+	}
+	if f.Period > 0 {
+		b = append(b, extPeriod, 8)
+		b = binary.BigEndian.AppendUint64(b, uint64(f.Period))
+	}
+	if f.SessionId != 0 {
+		b = append(b, extSession, 4)
+		b = binary.BigEndian.AppendUint32(b, f.SessionId)
+	}
+	return b
+}
+
 func (f *Frame) Write(b []byte) (n int, err error) {
 	var length uint16
 	var buf bytes.Buffer
 	if len(b) < MAX_FRAME_LENGTH {
 		return 0, fmt.Errorf("Input buffer too small")
 	}
-	if len(f.Metadata)+len(f.Data)+8 > MAX_FRAME_LENGTH { // 2xuint16 + 1xuint32
+	extensions := f.extensions()
+	if len(f.Metadata)+len(f.Data)+len(extensions)+8 > MAX_FRAME_LENGTH { // 2xuint16 + 1xuint32
 		return 0, fmt.Errorf("Frame larger than max frame length")
 	}
 	if err = binary.Write(&buf, binary.BigEndian, &f.FrameId); err != nil {
@@ -62,6 +134,7 @@ func (f *Frame) Write(b []byte) (n int, err error) {
 	if err = binary.Write(&buf, binary.BigEndian, f.Data); err != nil {
 		return 0, err
 	}
+	buf.Write(extensions)
 	bufbytes := buf.Bytes()
 	copy(b, bufbytes)
 	return len(bufbytes), nil
@@ -2,14 +2,23 @@ package streamcast
 
 import (
 	"log"
+	"sync"
+	"time"
 )
 
+// FrameCache is safe for concurrent use.
 type FrameCache struct {
+	mu           sync.Mutex
 	currentFrame uint32
 	cache        []*Frame
 	cacheSize    uint32
+	window       time.Duration
+	refStamp     time.Time
 }
 
+// Upper bound on frames held when the window is sized by time.
+const maxCacheGrowth = 1 << 16
+
 func NewFrameCache(cacheSize uint32) (fc *FrameCache) {
 	fc = new(FrameCache)
 	fc.cacheSize = cacheSize
@@ -17,7 +26,57 @@ func NewFrameCache(cacheSize uint32) (fc *FrameCache) {
 	return fc
 }
 
+// SetTimeWindow sizes the cache by time rather than frame count: frames are
+// admitted if their timestamp is less than window ahead of the last frame
+// returned by Get, growing the cache as needed. Frames without a timestamp
+// are still limited by the cache size.
+func (fc *FrameCache) SetTimeWindow(window time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.window = window
+}
+
+func (fc *FrameCache) grow(size uint32) {
+	if size < 2*fc.cacheSize {
+		size = 2 * fc.cacheSize
+	}
+	fc.resize(size)
+}
+
+// Resize changes the number of frames the cache holds. The size is raised if
+// needed to keep every cached frame.
+func (fc *FrameCache) Resize(size uint32) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.resize(size)
+}
+
+func (fc *FrameCache) resize(size uint32) {
+	for _, f := range fc.cache {
+		if f != nil && f.FrameId-fc.currentFrame >= size {
+			size = f.FrameId - fc.currentFrame + 1
+		}
+	}
+	if debug {
+		log.Printf("Resizing cache from %d to %d", fc.cacheSize, size)
+	}
+	cache := make([]*Frame, size)
+	for _, f := range fc.cache {
+		if f != nil {
+			cache[f.FrameId%size] = f
+		}
+	}
+	fc.cache = cache
+	fc.cacheSize = size
+}
+
 func (fc *FrameCache) FastForwardTo(frameId uint32) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.fastForwardTo(frameId)
+}
+
+func (fc *FrameCache) fastForwardTo(frameId uint32) {
 	// Clear cached frames that we advanced over.
 	maxToClear := frameId - fc.currentFrame
 	if debug {
@@ -38,8 +97,10 @@ func (fc *FrameCache) FastForwardTo(frameId uint32) {
 }
 
 func (fc *FrameCache) Get(frameId uint32) (f *Frame) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
 	if fc.currentFrame != frameId {
-		fc.FastForwardTo(frameId)
+		fc.fastForwardTo(frameId)
 	}
 
 	cacheIndex := fc.currentFrame % fc.cacheSize
@@ -50,29 +111,118 @@ func (fc *FrameCache) Get(frameId uint32) (f *Frame) {
 			log.Printf("Returning from cache %d idx %d \n", fc.currentFrame, cacheIndex)
 		}
 		fc.currentFrame++
+		if !f.Timestamp.IsZero() {
+			fc.refStamp = f.Timestamp
+		}
+		return f
+	}
+	return nil
+}
+
+// Peek returns frameId if cached without removing it. Like Get, it
+// advances the window to frameId.
+func (fc *FrameCache) Peek(frameId uint32) *Frame {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.currentFrame != frameId {
+		fc.fastForwardTo(frameId)
+	}
+	if f := fc.cache[frameId%fc.cacheSize]; f != nil && f.FrameId == frameId {
 		return f
 	}
 	return nil
 }
 
-func (fc *FrameCache) Put(f *Frame) {
+// Lookup returns frameId if cached, leaving the cache untouched.
+func (fc *FrameCache) Lookup(frameId uint32) *Frame {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if f := fc.cache[frameId%fc.cacheSize]; f != nil && f.FrameId == frameId {
+		return f
+	}
+	return nil
+}
+
+// Len returns the number of cached frames.
+func (fc *FrameCache) Len() (n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for _, f := range fc.cache {
+		if f != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Oldest returns the cached frame with the lowest id at or after the
+// current frame, or nil if the cache is empty.
+func (fc *FrameCache) Oldest() *Frame {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for i := fc.currentFrame; i != fc.currentFrame+fc.cacheSize; i++ {
+		if f := fc.cache[i%fc.cacheSize]; f != nil && f.FrameId == i {
+			return f
+		}
+	}
+	return nil
+}
+
+// Newest returns the cached frame with the highest id, or nil if the cache
+// is empty.
+func (fc *FrameCache) Newest() *Frame {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for i := fc.currentFrame + fc.cacheSize - 1; i != fc.currentFrame-1; i-- {
+		if f := fc.cache[i%fc.cacheSize]; f != nil && f.FrameId == i {
+			return f
+		}
+	}
+	return nil
+}
+
+// Outcome of FrameCache.Put.
+type PutResult int
+
+const (
+	PutStored PutResult = iota
+	PutDuplicate
+	PutOutOfWindow
+)
+
+func (fc *FrameCache) Put(f *Frame) PutResult {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
 	// Drop frames so far in the future, they're outside our window
 	distanceFromNow := f.FrameId - fc.currentFrame
 	if debug {
 		log.Printf("cache dist from now == %d; cache size == %d", distanceFromNow, fc.cacheSize)
 	}
+	if fc.window > 0 && !f.Timestamp.IsZero() {
+		if !fc.refStamp.IsZero() && f.Timestamp.Sub(fc.refStamp) >= fc.window {
+			if debug {
+				log.Printf("Dropped received frame (timestamp outside window)")
+			}
+			return PutOutOfWindow
+		}
+		if distanceFromNow >= fc.cacheSize && distanceFromNow < maxCacheGrowth {
+			fc.grow(distanceFromNow + 1)
+		}
+	}
 	if distanceFromNow >= fc.cacheSize {
 		if debug {
 			log.Printf("Dropped received frame (data coming faster than expected)")
 		}
-		return
+		return PutOutOfWindow
 	}
 
 	if debug {
 		log.Printf("Setting %d idx %d\n", f.FrameId, f.FrameId%fc.cacheSize)
 	}
 	cacheidx := f.FrameId % fc.cacheSize
-	if fc.cache[cacheidx] == nil {
-		fc.cache[cacheidx] = f
+	if fc.cache[cacheidx] != nil {
+		return PutDuplicate
 	}
+	fc.cache[cacheidx] = f
+	return PutStored
 }
@@ -0,0 +1,82 @@
+package streamcast
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log"
+)
+
+// On stream transports (TCP, Unix stream) every frame is preceded by a
+// header of two magic bytes and the u16 big endian frame length, so frames
+// survive segmentation and coalescing. A receiver that finds anything else
+// scans forward byte by byte until a header followed by a valid frame.
+const (
+	streamMagic0       = 'S'
+	streamMagic1       = 'C'
+	streamFrameHeader  = 4
+	streamReaderBuffer = streamFrameHeader + MAX_FRAME_LENGTH
+)
+
+// appendStreamFrame appends the header and frame to b.
+func appendStreamFrame(b []byte, frame []byte) []byte {
+	b = append(b, streamMagic0, streamMagic1)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(frame)))
+	return append(b, frame...)
+}
+
+// streamFramer splits a byte stream back into frames. Partial frames stay
+// buffered across deadline errors.
+type streamFramer struct {
+	reader *bufio.Reader
+}
+
+func newStreamFramer(r io.Reader) *streamFramer {
+	return &streamFramer{reader: bufio.NewReaderSize(r, streamReaderBuffer)}
+}
+
+// Read the next frame into b.
+func (s *streamFramer) Read(b []byte) (int, error) {
+	for {
+		header, err := s.reader.Peek(streamFrameHeader)
+		if err != nil {
+			return 0, err
+		}
+		length := int(binary.BigEndian.Uint16(header[2:]))
+		if header[0] != streamMagic0 || header[1] != streamMagic1 || length > MAX_FRAME_LENGTH {
+			s.skip()
+			continue
+		}
+		packet, err := s.reader.Peek(streamFrameHeader + length)
+		if err != nil {
+			return 0, err
+		}
+		if !validFrame(packet[streamFrameHeader:]) {
+			// The magic bytes were part of something else.
+			s.skip()
+			continue
+		}
+		n := copy(b, packet[streamFrameHeader:])
+		s.reader.Discard(streamFrameHeader + length)
+		return n, nil
+	}
+}
+
+// Whether the metadata and data lengths of the frame in b fit in b.
+func validFrame(b []byte) bool {
+	offset := 4
+	for i := 0; i < 2; i++ {
+		if len(b) < offset+2 {
+			return false
+		}
+		offset += 2 + int(binary.BigEndian.Uint16(b[offset:]))
+	}
+	return offset <= len(b)
+}
+
+func (s *streamFramer) skip() {
+	if debug {
+		log.Printf("Stream out of sync, skipping a byte")
+	}
+	s.reader.Discard(1)
+}
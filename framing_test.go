@@ -0,0 +1,211 @@
+package streamcast
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func streamFrame(t *testing.T, id uint32) []byte {
+	t.Helper()
+	var b [MAX_FRAME_LENGTH]byte
+	f := makeFrame(id)
+	n, err := f.Write(b[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return appendStreamFrame(nil, b[:n])
+}
+
+func TestTcpFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	var writes [][]byte
+	// Coalesced: two frames in one segment.
+	writes = append(writes, append(streamFrame(t, 1), streamFrame(t, 2)...))
+	// Fragmented: a frame split across many segments.
+	for _, b := range streamFrame(t, 3) {
+		writes = append(writes, []byte{b})
+	}
+	// Garbage, including a false header, before a frame.
+	writes = append(writes, append([]byte{0xff, 'S', 'C', 0, 3, 1, 2, 3, 'S'}, streamFrame(t, 4)...))
+
+	// The sender holds the connection open until the test is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*net.TCPConn).SetNoDelay(true)
+		for _, b := range writes {
+			if _, err = conn.Write(b); err != nil {
+				return
+			}
+			// Pause so each write goes out as its own segment.
+			time.Sleep(time.Millisecond)
+		}
+		<-done
+	}()
+
+	conn, err := NewTcpRxConn("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, expected := range []uint32{1, 2, 3, 4} {
+		f, _ := readFrom(t, conn)
+		if f.FrameId != expected {
+			t.Fatalf("Received frame %d, expected %d", f.FrameId, expected)
+		}
+	}
+}
+
+func TestTcpFramingBurst(t *testing.T) {
+	tx, err := NewTcpTx("127.0.0.1", 8901)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	rx, err := NewRxIsochronous("tcp", "127.0.0.1", 8901, time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+	waitForSubscribers(t, tx, 1)
+
+	for id := uint32(1); id <= 50; id++ {
+		f := makeFrame(id)
+		if err = tx.Write(f.Metadata, f.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := uint32(1); id <= 50; id++ {
+		expectFrame(t, rx, id)
+	}
+}
+
+func tcpTxPort(tx *TcpTx) int {
+	return tx.tcpServer.listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestTcpClientInputIgnored(t *testing.T) {
+	tx, err := NewTcpTx("127.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	port := tcpTxPort(tx)
+	rx, err := NewTcpRxConn("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rx.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+	intruder, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer intruder.Close()
+	waitForSubscribers(t, tx, 2)
+
+	// A well formed frame from one subscriber must not reach the others.
+	if _, err = intruder.Write(streamFrame(t, 99)); err != nil {
+		t.Fatal(err)
+	}
+	f := makeFrame(1)
+	tx.Write(f.Metadata, f.Data)
+	if f, _ := readFrom(t, rx); f.FrameId != 1 {
+		t.Fatalf("Received injected frame %d", f.FrameId)
+	}
+}
+
+func TestTcpStalledClient(t *testing.T) {
+	tx, err := NewTcpTx("127.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	tx.SetTimeout(50 * time.Millisecond)
+	port := tcpTxPort(tx)
+
+	// Connects but never reads.
+	stalled, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	rx, err := NewTcpRxConn("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rx.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+	waitForSubscribers(t, tx, 2)
+
+	// The healthy client keeps reading throughout.
+	last := make(chan error, 1)
+	go func() {
+		var b [MAX_FRAME_LENGTH]byte
+		for {
+			rx.SetDeadline(time.Now().Add(5 * time.Second))
+			n, err := rx.Read(b[:])
+			if err != nil {
+				last <- err
+				return
+			}
+			var f Frame
+			if f.Read(b[:n]) == nil && string(f.Data) == "last" {
+				last <- nil
+				return
+			}
+		}
+	}()
+
+	// Write until the stalled client's socket buffers fill and it is
+	// dropped. Writes never wait for it.
+	stalled.(*net.TCPConn).SetReadBuffer(4096)
+	data := make([]byte, 1024)
+	for start := time.Now(); len(tx.tcpServer.connected()) != 1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Stalled client never dropped")
+		}
+		writeStart := time.Now()
+		for i := 0; i < clientQueue/2; i++ {
+			if err = tx.Write(nil, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if elapsed := time.Since(writeStart); elapsed > 10*time.Millisecond {
+			t.Fatalf("Writes took %v", elapsed)
+		}
+	}
+
+	// The healthy client still gets frames, once its own queue has room.
+	for {
+		tx.Write(nil, []byte("last"))
+		select {
+		case err = <-last:
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
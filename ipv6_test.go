@@ -0,0 +1,122 @@
+package streamcast
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func ipv6Loopback(t *testing.T) {
+	t.Helper()
+	c, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback unavailable")
+	}
+	c.Close()
+}
+
+// Wait for a stream Tx to have registered n clients. Datagram Txs have no
+// clients to wait for.
+func waitForSubscribers(t *testing.T, tx Tx, n int) {
+	t.Helper()
+	var server *TcpServer
+	switch tx := tx.(type) {
+	case *TcpTx:
+		server = tx.tcpServer
+	case *UnixTx:
+		server = tx.tcpServer
+	default:
+		return
+	}
+	for start := time.Now(); len(server.connected()) != n; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("%d clients, expected %d", len(server.connected()), n)
+		}
+	}
+}
+
+func TestIPv6Transports(t *testing.T) {
+	ipv6Loopback(t)
+	for _, protocol := range []string{"udp", "udp6", "tcp", "tcp6"} {
+		tx, err := NewTx(protocol, "::1", 8899)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rx, err := NewRxIsochronous(protocol, "::1", 8899, time.Millisecond, 100*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitForSubscribers(t, tx, 1)
+		f := makeFrame(1)
+		if err = tx.Write(f.Metadata, f.Data); err != nil {
+			t.Fatal(err)
+		}
+		frame, err := rx.Read()
+		if err != nil {
+			t.Fatalf("%s: %v", protocol, err)
+		}
+		if extractDataPayload(frame.Data) != 1 {
+			t.Fatalf("%s: received incorrect frame", protocol)
+		}
+		if ip := frame.Source.String(); ip[0] != '[' {
+			t.Fatalf("%s: unexpected source %s", protocol, ip)
+		}
+		rx.Close()
+		tx.Close()
+	}
+}
+
+func TestIPv6Multicast(t *testing.T) {
+	ipv6Loopback(t)
+	// IPv6 has no multicast route on loopback, use a real interface.
+	var ifi *net.Interface
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ifaces {
+		if ifaces[i].Flags&net.FlagMulticast != 0 && ifaces[i].Flags&net.FlagUp != 0 {
+			ifi = &ifaces[i]
+			break
+		}
+	}
+	if ifi == nil {
+		t.Skip("No multicast interface")
+	}
+	group := "ff02::1:2%" + ifi.Name
+
+	// Link scoped multicast is sent from the link-local address.
+	var source string
+	addrs, _ := ifi.Addrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsLinkLocalUnicast() && ipNet.IP.To4() == nil {
+			source = ipNet.IP.String()
+		}
+	}
+	if source == "" {
+		t.Skip("No IPv6 link-local address")
+	}
+
+	for _, sources := range [][]string{nil, {source}} {
+		conn, err := NewMulticastRxConn(group, 8900, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = conn.SetMulticastSources(sources...); err != nil {
+			t.Fatal(err)
+		}
+		rx, err := InitRxIsochronous(conn, time.Millisecond, 100*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Sources %v: %v", sources, err)
+		}
+
+		tx := multicastTx(t, group, 8900, ifi)
+		f := makeFrame(1)
+		if err = tx.WriteFrame(&f); err != nil {
+			t.Fatal(err)
+		}
+		expectFrame(t, rx, 1)
+		tx.Close()
+		rx.Close()
+	}
+}
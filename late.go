@@ -0,0 +1,75 @@
+package streamcast
+
+import (
+	"log"
+	"time"
+)
+
+// LatePolicy selects what happens to frames that arrive after their
+// playout slot has passed.
+type LatePolicy int
+
+const (
+	// Drop late frames (the default).
+	LateDiscard LatePolicy = iota
+	// Return late frames from Read with Late set.
+	LateInline
+	// Send late frames to the channel returned by Late.
+	LateChannel
+)
+
+const (
+	lateChannelSize  = 64
+	deliveredHistory = 256
+)
+
+// SetLateDelivery selects how late frames are surfaced. Late frames never
+// move the isochronous timeline. Duplicates of frames that were already
+// delivered are still dropped.
+func (r *RxIsochronous) SetLateDelivery(policy LatePolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latePolicy = policy
+	if policy == LateChannel && r.late == nil {
+		r.late = make(chan *Frame, lateChannelSize)
+	}
+}
+
+// Late returns the channel late frames are sent to under LateChannel. Frames
+// are dropped if the channel is full.
+func (r *RxIsochronous) Late() <-chan *Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.late
+}
+
+func (r *RxIsochronous) markDelivered(frameId uint32) {
+	r.delivered[frameId%deliveredHistory] = uint64(frameId) + 1
+}
+
+func (r *RxIsochronous) wasDelivered(frameId uint32) bool {
+	return r.delivered[frameId%deliveredHistory] == uint64(frameId)+1
+}
+
+// Handle a frame that arrived behind the timeline and was never delivered.
+// Returns true if the frame should be returned from Read.
+func (r *RxIsochronous) handleLate(f *Frame, arrival time.Time) bool {
+	if r.latePolicy == LateDiscard {
+		return false
+	}
+	f.Late = true
+	if r.hasTimeline() {
+		f.Lateness = arrival.Sub(r.releaseAt(f.FrameId, f).Add(r.buffer))
+	}
+	if debug {
+		log.Printf("Late frame %d by %v", f.FrameId, f.Lateness)
+	}
+	if r.latePolicy == LateInline {
+		return true
+	}
+	select {
+	case r.late <- f:
+	default:
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package streamcast
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// NewMulticastRxConn receives from an IPv4 or IPv6 multicast group, joined
+// on ifi, the zone of a scoped IPv6 group, or the default multicast
+// interface. Use SetMulticastSources for
+// source-specific multicast.
+func NewMulticastRxConn(group string, port int, ifi *net.Interface) (c *UdpRxConn, err error) {
+	c, err = NewUdpRxConn(group, port)
+	if err != nil {
+		return nil, err
+	}
+	if !c.addr.IP.IsMulticast() {
+		return nil, fmt.Errorf("Not a multicast address: %s", group)
+	}
+	c.group = c.addr.IP
+	c.ifi = ifi
+	if ifi == nil && c.addr.Zone != "" {
+		// A scoped IPv6 group such as ff02::1%eth0 names its interface.
+		if c.ifi, err = net.InterfaceByName(c.addr.Zone); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// SetMulticastSources restricts the group membership to the given senders
+// (SSM). No sources joins the whole group (ASM). Takes effect on Reset.
+// SSM is only supported on Linux.
+func (udpRxConn *UdpRxConn) SetMulticastSources(sources ...string) (err error) {
+	var ips []net.IP
+	for _, source := range sources {
+		ip := net.ParseIP(source)
+		if ip == nil {
+			return fmt.Errorf("Invalid source address: %s", source)
+		}
+		ips = append(ips, ip)
+	}
+	udpRxConn.mu.Lock()
+	defer udpRxConn.mu.Unlock()
+	udpRxConn.sources = ips
+	return
+}
+
+// Listen on the group port and join the group. Given a multicast address,
+// package net binds the wildcard address with SO_REUSEADDR, so receivers on
+// the host can share the group. Whole-group membership goes through the
+// portable net.ListenMulticastUDP; source-specific membership needs socket
+// options only implemented on Linux. Must be called with udpRxConn.mu held.
+func (udpRxConn *UdpRxConn) listenMulticast() (conn *net.UDPConn, err error) {
+	network := udpNetwork(udpRxConn.group)
+	if len(udpRxConn.sources) == 0 {
+		return net.ListenMulticastUDP(network, udpRxConn.ifi, udpRxConn.addr)
+	}
+	pc, err := net.ListenPacket(network, udpRxConn.addr.String())
+	if err != nil {
+		return nil, err
+	}
+	conn = pc.(*net.UDPConn)
+	if err = udpRxConn.joinSources(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (udpRxConn *UdpRxConn) joinSources(conn *net.UDPConn) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	for _, source := range udpRxConn.sources {
+		if err = joinGroup(rc, udpRxConn.group, source, udpRxConn.ifi); err != nil {
+			return fmt.Errorf("Joining %s from %s: %w", udpRxConn.group, source, err)
+		}
+	}
+	return nil
+}
+
+func (s *UdpTx) rawConn() (syscall.RawConn, error) {
+	conn, ok := s.conn.(syscall.Conn)
+	if !ok {
+		return nil, fmt.Errorf("Connection does not support socket options")
+	}
+	return conn.SyscallConn()
+}
+
+// Whether frames are sent over IPv6, choosing the family of socket options.
+func (s *UdpTx) ipv6() bool {
+	return s.addrs[0].(*net.UDPAddr).IP.To4() == nil
+}
+
+// SetMulticastTTL sets the hop limit of multicast frames. The default of 1
+// keeps them on the local network.
+func (s *UdpTx) SetMulticastTTL(ttl int) error {
+	rc, err := s.rawConn()
+	if err != nil {
+		return err
+	}
+	return setMulticastTTL(rc, s.ipv6(), ttl)
+}
+
+// SetMulticastInterface sends multicast frames out of ifi rather than the
+// interface chosen by the routing table.
+func (s *UdpTx) SetMulticastInterface(ifi *net.Interface) error {
+	rc, err := s.rawConn()
+	if err != nil {
+		return err
+	}
+	return setMulticastInterface(rc, s.ipv6(), ifi)
+}
+
+// SetMulticastLoopback controls whether multicast frames are also delivered
+// to receivers on this host. Enabled by default. Loopback is decided by the
+// sending socket; receivers have no say.
+func (s *UdpTx) SetMulticastLoopback(enabled bool) error {
+	rc, err := s.rawConn()
+	if err != nil {
+		return err
+	}
+	return setMulticastLoop(rc, s.ipv6(), enabled)
+}
+
+func ifindex(ifi *net.Interface) int {
+	if ifi == nil {
+		return 0
+	}
+	return ifi.Index
+}
+
+func interfaceAddr4(ifi *net.Interface) (net.IP, error) {
+	if ifi == nil {
+		return net.IPv4zero.To4(), nil
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4(), nil
+		}
+	}
+	return nil, fmt.Errorf("Interface %s has no IPv4 address", ifi.Name)
+}
@@ -0,0 +1,103 @@
+package streamcast
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func loopbackInterface(t *testing.T) *net.Interface {
+	t.Helper()
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ifaces {
+		if ifaces[i].Flags&net.FlagLoopback != 0 {
+			return &ifaces[i]
+		}
+	}
+	t.Skip("No loopback interface")
+	return nil
+}
+
+func multicastTx(t *testing.T, group string, port int, ifi *net.Interface) *UdpTx {
+	t.Helper()
+	tx, err := NewUdpTx(group, port, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.SetMulticastInterface(ifi); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.SetMulticastTTL(1); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.SetMulticastLoopback(true); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestMulticastLoopback(t *testing.T) {
+	lo := loopbackInterface(t)
+	conn, err := NewMulticastRxConn("239.1.2.3", 8896, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx, err := InitRxIsochronous(conn, time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+
+	tx := multicastTx(t, "239.1.2.3", 8896, lo)
+	defer tx.Close()
+	f := makeFrame(1)
+	if err = tx.WriteFrame(&f); err != nil {
+		t.Fatal(err)
+	}
+	expectFrame(t, rx, 1)
+}
+
+func TestMulticastSourceSpecific(t *testing.T) {
+	lo := loopbackInterface(t)
+	if _, err := NewMulticastRxConn("127.0.0.1", 8897, lo); err == nil {
+		t.Fatalf("Expected error for unicast group")
+	}
+	conn, err := NewMulticastRxConn("232.1.2.3", 8897, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.SetMulticastSources("127.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Only the joined source gets through.
+	for _, from := range []string{"127.0.0.1", "127.0.0.2"} {
+		laddr := &net.UDPAddr{IP: net.ParseIP(from)}
+		c, err := net.ListenUDP("udp4", laddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, _ := c.SyscallConn()
+		if err = setMulticastInterface(rc, false, lo); err != nil {
+			t.Fatal(err)
+		}
+		var b [MAX_FRAME_LENGTH]byte
+		f := makeFrame(uint32(laddr.IP.To4()[3]))
+		n, _ := f.Write(b[:])
+		if _, err = c.WriteToUDP(b[:n], &net.UDPAddr{IP: net.ParseIP("232.1.2.3"), Port: 8897}); err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+	}
+	f, addr := readFrom(t, conn)
+	if f.FrameId != 2 || addr.(*net.UDPAddr).IP.String() != "127.0.0.2" {
+		t.Fatalf("Received frame %d from %v", f.FrameId, addr)
+	}
+}
@@ -0,0 +1,91 @@
+package streamcast
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// Frames cached while the period is unknown.
+	detectCacheSize = 64
+	// Frames measured before inferring the period.
+	detectFrames = 8
+
+	// Periods outside these bounds, advertised or inferred, are ignored.
+	// Anything shorter would size the cache beyond reason.
+	minFramePeriod = 100 * time.Microsecond
+	maxFramePeriod = 10 * time.Second
+)
+
+type periodSample struct {
+	frameId uint32
+	at      time.Time
+}
+
+// FramePeriod returns the frame period in use, or zero while it is still
+// being detected.
+func (r *RxIsochronous) FramePeriod() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.framePeriod
+}
+
+// Learn the frame period from a received frame. A period advertised by the
+// sender is used as is; otherwise it is inferred from sender timestamps, or
+// arrival times if there are none, once enough frames have been seen.
+func (r *RxIsochronous) detectPeriod(f *Frame, arrival time.Time) {
+	if f.Period > 0 && r.setFramePeriod(f.Period) {
+		return
+	}
+	at := arrival
+	if !f.Timestamp.IsZero() {
+		at = f.Timestamp
+	}
+	// Measure over the most recent detectFrames frames.
+	sample := periodSample{f.FrameId, at}
+	if len(r.periodSamples) < detectFrames {
+		r.periodSamples = append(r.periodSamples, sample)
+	} else {
+		copy(r.periodSamples, r.periodSamples[1:])
+		r.periodSamples[detectFrames-1] = sample
+	}
+	if len(r.periodSamples) < detectFrames {
+		return
+	}
+
+	first, last := r.periodSamples[0], r.periodSamples[0]
+	for _, s := range r.periodSamples {
+		if int32(s.frameId-first.frameId) < 0 {
+			first = s
+		}
+		if int32(s.frameId-last.frameId) > 0 {
+			last = s
+		}
+	}
+	span := last.frameId - first.frameId
+	elapsed := last.at.Sub(first.at)
+	if span == 0 || elapsed <= 0 {
+		return
+	}
+	r.setFramePeriod(elapsed / time.Duration(span))
+}
+
+// Reports false, leaving the period unknown, if it is out of bounds.
+func (r *RxIsochronous) setFramePeriod(period time.Duration) bool {
+	if period < minFramePeriod || period > maxFramePeriod {
+		if debug {
+			log.Printf("Ignoring frame period %v", period)
+		}
+		return false
+	}
+	if debug {
+		log.Printf("Detected frame period %v", period)
+	}
+	r.framePeriod = period
+	r.periodSamples = nil
+	r.cache.Resize(r.windowSize())
+	if r.vfr {
+		r.cache.SetTimeWindow(r.buffer + r.preroll + 2*r.framePeriod)
+	}
+	return true
+}
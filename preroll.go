@@ -0,0 +1,52 @@
+package streamcast
+
+import (
+	"log"
+	"time"
+)
+
+// SetPreroll enables an initial buffering phase. After the first frame,
+// frames are accumulated until duration has elapsed or depth frames are
+// cached, whichever comes first (a zero value disables that limit). Frames
+// are then released no earlier than their slot on the isochronous timeline.
+// The steady-state latency is still governed by the buffer passed at
+// construction. Must be called before the first Read.
+func (r *RxIsochronous) SetPreroll(duration time.Duration, depth int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.preroll = duration
+	r.prerollDepth = depth
+	r.resizeCache()
+}
+
+// Whether frames are held until their release time.
+func (r *RxIsochronous) paced() bool {
+	return r.preroll > 0 || r.prerollDepth > 0
+}
+
+func (r *RxIsochronous) prerolling() bool {
+	return r.state == StateBuffering && (r.paced() || r.framePeriod == 0)
+}
+
+func (r *RxIsochronous) prerollDone(now time.Time) bool {
+	if r.framePeriod == 0 {
+		return false
+	}
+	if !r.paced() {
+		return true
+	}
+	if r.preroll > 0 && !now.Before(r.baseTime.Add(r.preroll)) {
+		return true
+	}
+	return r.prerollDepth > 0 && r.cache.Len() >= r.prerollDepth
+}
+
+// End the pre-roll, releasing the base frame now.
+func (r *RxIsochronous) startPlayout(now time.Time) {
+	if debug {
+		log.Printf("Pre-roll complete with %d frames cached", r.cache.Len())
+	}
+	r.baseTime = now
+	r.lastRelease = now
+	r.setState(StatePlaying)
+}
@@ -0,0 +1,143 @@
+package streamcast
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+const (
+	receiverFrameQueue = 16
+	receiverEventQueue = 16
+)
+
+type ReceiverEventKind int
+
+const (
+	// A frame missed its deadline.
+	EventUnderrun ReceiverEventKind = iota
+	// Read failed. Err holds the error. Unless it wraps ErrInvalidFrame
+	// the receiver stops.
+	EventError
+)
+
+type ReceiverEvent struct {
+	Kind ReceiverEventKind
+	Err  error
+}
+
+// Receiver runs the RxIsochronous read loop on its own goroutine and
+// delivers frames on a channel or to a handler.
+type Receiver struct {
+	rx      *RxIsochronous
+	frames  chan *Frame
+	events  chan ReceiverEvent
+	onFrame func(f *Frame)
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func NewReceiver(rx *RxIsochronous) (m *Receiver) {
+	m = new(Receiver)
+	m.rx = rx
+	m.frames = make(chan *Frame, receiverFrameQueue)
+	m.events = make(chan ReceiverEvent, receiverEventQueue)
+	m.done = make(chan struct{})
+	return m
+}
+
+// OnFrame delivers frames to fn on the receive goroutine instead of the
+// Frames channel. Must be called before Start. fn must not call Stop, which
+// would wait for fn to return.
+func (m *Receiver) OnFrame(fn func(f *Frame)) {
+	m.onFrame = fn
+}
+
+// Frames returns the delivery channel. It is closed when the receiver stops.
+func (m *Receiver) Frames() <-chan *Frame {
+	return m.frames
+}
+
+// Events returns underruns and errors. Events are dropped if the channel is
+// full, so a slow consumer never stalls frame delivery. It is closed when
+// the receiver stops.
+func (m *Receiver) Events() <-chan ReceiverEvent {
+	return m.events
+}
+
+// Done is closed once the receive goroutine has exited, either after Stop
+// or because reading failed for good.
+func (m *Receiver) Done() <-chan struct{} {
+	return m.done
+}
+
+// Start launches the receive goroutine. Later calls do nothing.
+func (m *Receiver) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return
+	}
+	var ctx context.Context
+	ctx, m.cancel = context.WithCancel(context.Background())
+	go m.run(ctx)
+}
+
+// Stop ends the read loop and waits for the receive goroutine to exit. It
+// does nothing if the receiver was never started.
+func (m *Receiver) Stop() {
+	m.mu.Lock()
+	cancel := m.cancel
+	m.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-m.done
+}
+
+func (m *Receiver) run(ctx context.Context) {
+	defer close(m.done)
+	defer close(m.events)
+	defer close(m.frames)
+
+	for {
+		f, err := m.rx.ReadContext(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			neterr, ok := err.(net.Error)
+			if ok && neterr.Timeout() {
+				m.event(ReceiverEvent{Kind: EventUnderrun, Err: err})
+				continue
+			}
+			m.event(ReceiverEvent{Kind: EventError, Err: err})
+			// Anything but a bad packet, such as a closed or broken
+			// connection, would fail again on every read.
+			if errors.Is(err, ErrInvalidFrame) {
+				continue
+			}
+			return
+		}
+
+		if m.onFrame != nil {
+			m.onFrame(f)
+			continue
+		}
+		select {
+		case m.frames <- f:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Receiver) event(e ReceiverEvent) {
+	select {
+	case m.events <- e:
+	default:
+	}
+}
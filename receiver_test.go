@@ -0,0 +1,82 @@
+package streamcast
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReceiverDeliversFramesAndUnderruns(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	m := NewReceiver(rx)
+	m.Start()
+
+	conn.push(1, 2, 3)
+	for i := uint32(1); i <= 3; i++ {
+		f := <-m.Frames()
+		if extractDataPayload(f.Data) != i {
+			t.Fatalf("Expected %d got %d", i, extractDataPayload(f.Data))
+		}
+	}
+
+	clock.BlockUntil(1)
+	clock.Advance(5 * time.Millisecond)
+	if e := <-m.Events(); e.Kind != EventUnderrun {
+		t.Fatalf("Expected underrun event, got %+v", e)
+	}
+
+	m.Stop()
+	select {
+	case <-m.Done():
+	default:
+		t.Fatalf("Receive goroutine still running after Stop")
+	}
+	if _, ok := <-m.Frames(); ok {
+		t.Fatalf("Frames channel not closed")
+	}
+}
+
+func TestReceiverOnFrame(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	m := NewReceiver(rx)
+	got := make(chan uint32, 2)
+	m.OnFrame(func(f *Frame) {
+		got <- extractDataPayload(f.Data)
+	})
+	m.Start()
+	defer m.Stop()
+
+	conn.push(1, 2)
+	if <-got != 1 || <-got != 2 {
+		t.Fatalf("Handler received frames out of order")
+	}
+}
+
+func TestReceiverStopsOnPersistentError(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	m := NewReceiver(rx)
+	// Stopping before starting leaves the receiver usable.
+	m.Stop()
+	m.Start()
+	defer m.Stop()
+
+	conn.packets <- []byte{1}
+	conn.push(1)
+	if e := <-m.Events(); e.Kind != EventError || !errors.Is(e.Err, ErrInvalidFrame) {
+		t.Fatalf("Expected invalid frame event, got %+v", e)
+	}
+	if f := <-m.Frames(); extractDataPayload(f.Data) != 1 {
+		t.Fatalf("Expected frame 1 after the bad packet")
+	}
+
+	conn.errs <- io.EOF
+	if e := <-m.Events(); e.Kind != EventError || e.Err != io.EOF {
+		t.Fatalf("Expected EOF event, got %+v", e)
+	}
+	select {
+	case <-m.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Receiver still running after EOF")
+	}
+}
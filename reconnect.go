@@ -0,0 +1,262 @@
+package streamcast
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net"
+	"os"
+	"time"
+)
+
+const tcpDialTimeout = 5 * time.Second
+
+// ErrReconnected is returned by an RxConn once after it re-established a
+// lost connection. RxIsochronous handles it per its ReconnectPolicy.
+var ErrReconnected = errors.New("Reconnected")
+
+// ConnState is the state of a reconnecting TCP receiver connection.
+type ConnState int
+
+const (
+	// Connected to the server, initially or after a reconnect.
+	ConnConnected ConnState = iota
+	// The connection was lost. Err holds the cause.
+	ConnDisconnected
+	// A connection attempt failed and will be retried after a backoff.
+	ConnRetrying
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnected:
+		return "connected"
+	case ConnDisconnected:
+		return "disconnected"
+	case ConnRetrying:
+		return "retrying"
+	}
+	return "unknown"
+}
+
+// ConnStateFunc is called on connection state changes, with the error that
+// caused them if any. It runs on the goroutine calling Reset or Read and
+// must not block.
+type ConnStateFunc func(state ConnState, err error)
+
+// SetReconnect enables reconnecting when the connection is lost, with an
+// exponential backoff from initial to max between attempts, each randomly
+// shortened by up to half to spread out clients. Reconnection is driven by
+// Read, which keeps honoring its deadline meanwhile: connection attempts
+// run in the background, limited only by their own timeout and Close, and
+// Read returns timeouts while one is pending. A zero initial disables
+// reconnecting.
+func (tcpRxConn *TcpRxConn) SetReconnect(initial time.Duration, max time.Duration) {
+	tcpRxConn.mu.Lock()
+	defer tcpRxConn.mu.Unlock()
+	tcpRxConn.reconnectMin = initial
+	tcpRxConn.reconnectMax = max
+}
+
+// OnConnState registers fn for connection state changes.
+func (tcpRxConn *TcpRxConn) OnConnState(fn ConnStateFunc) {
+	tcpRxConn.mu.Lock()
+	defer tcpRxConn.mu.Unlock()
+	tcpRxConn.connState = fn
+}
+
+func (tcpRxConn *TcpRxConn) notify(state ConnState, err error) {
+	tcpRxConn.mu.Lock()
+	fn := tcpRxConn.connState
+	tcpRxConn.mu.Unlock()
+	if debug {
+		log.Printf("Connection to %s %s: %v", tcpRxConn.addr, state, err)
+	}
+	if fn != nil {
+		fn(state, err)
+	}
+}
+
+// Whether err means conn was lost and should be re-established, in which
+// case it is marked broken.
+func (tcpRxConn *TcpRxConn) lost(conn net.Conn, err error) bool {
+	if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+		return false
+	}
+	tcpRxConn.mu.Lock()
+	defer tcpRxConn.mu.Unlock()
+	if tcpRxConn.reconnectMin <= 0 || tcpRxConn.closed || tcpRxConn.conn != conn {
+		return false
+	}
+	conn.Close()
+	tcpRxConn.broken = true
+	tcpRxConn.backoff = 0
+	tcpRxConn.nextAttempt = time.Time{}
+	return true
+}
+
+// Schedule the next attempt after a failed one. Must be called with
+// tcpRxConn.mu held.
+func (tcpRxConn *TcpRxConn) retryLater() {
+	tcpRxConn.broken = true
+	tcpRxConn.backoff *= 2
+	if tcpRxConn.backoff < tcpRxConn.reconnectMin {
+		tcpRxConn.backoff = tcpRxConn.reconnectMin
+	}
+	if tcpRxConn.reconnectMax > 0 && tcpRxConn.backoff > tcpRxConn.reconnectMax {
+		tcpRxConn.backoff = tcpRxConn.reconnectMax
+	}
+	jitter := tcpRxConn.backoff / 2
+	tcpRxConn.nextAttempt = time.Now().Add(tcpRxConn.backoff - rand.N(jitter+1))
+}
+
+// A connection attempt running in the background. conn and err are set
+// before done is closed.
+type pendingDial struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	conn   net.Conn
+	err    error
+}
+
+// Start dialing in the background, so that a slow connect or handshake is
+// not cut short by the read deadline. Must be called with tcpRxConn.mu
+// held.
+func (tcpRxConn *TcpRxConn) startDial() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &pendingDial{done: make(chan struct{}), cancel: cancel}
+	tcpRxConn.pending = p
+	go func() {
+		conn, err := tcpRxConn.dial(ctx)
+		cancel()
+		tcpRxConn.mu.Lock()
+		defer tcpRxConn.mu.Unlock()
+		if tcpRxConn.pending != p && conn != nil {
+			// Abandoned by Reset or Close.
+			conn.Close()
+			conn, err = nil, net.ErrClosed
+		}
+		p.conn, p.err = conn, err
+		close(p.done)
+	}()
+}
+
+// Cancel the background dial, if any, and close its connection if it
+// already succeeded. Must be called with tcpRxConn.mu held.
+func (tcpRxConn *TcpRxConn) abandonDial() {
+	p := tcpRxConn.pending
+	if p == nil {
+		return
+	}
+	tcpRxConn.pending = nil
+	p.cancel()
+	select {
+	case <-p.done:
+		if p.conn != nil {
+			p.conn.Close()
+		}
+	default:
+	}
+}
+
+// Re-establish the connection, returning ErrReconnected on success, a
+// timeout once the read deadline passes, or net.ErrClosed.
+func (tcpRxConn *TcpRxConn) reconnect() error {
+	for {
+		tcpRxConn.mu.Lock()
+		if tcpRxConn.closed {
+			tcpRxConn.mu.Unlock()
+			return net.ErrClosed
+		}
+		pending := tcpRxConn.pending
+		if pending != nil {
+			select {
+			case <-pending.done:
+				tcpRxConn.pending = nil
+				err := pending.err
+				if err == nil {
+					err = tcpRxConn.connected(pending.conn)
+					tcpRxConn.mu.Unlock()
+					if err != nil {
+						return err
+					}
+					tcpRxConn.notify(ConnConnected, nil)
+					return ErrReconnected
+				}
+				tcpRxConn.retryLater()
+				tcpRxConn.mu.Unlock()
+				tcpRxConn.notify(ConnRetrying, err)
+				continue
+			default:
+			}
+		}
+		now := time.Now()
+		deadline := tcpRxConn.deadline
+		if !deadline.IsZero() && !now.Before(deadline) {
+			tcpRxConn.mu.Unlock()
+			return os.ErrDeadlineExceeded
+		}
+		wait := tcpRxConn.nextAttempt.Sub(now)
+		if pending == nil && wait <= 0 {
+			tcpRxConn.startDial()
+			tcpRxConn.mu.Unlock()
+			continue
+		}
+		if !deadline.IsZero() && (pending != nil || deadline.Before(tcpRxConn.nextAttempt)) {
+			wait = deadline.Sub(now)
+		}
+		tcpRxConn.mu.Unlock()
+
+		// Sleep until the next attempt, or while one is pending until it
+		// completes, either way no longer than the deadline.
+		var done chan struct{}
+		var timeout <-chan time.Time
+		if pending != nil {
+			done = pending.done
+		}
+		var timer *time.Timer
+		if pending == nil || !deadline.IsZero() {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-timeout:
+		case <-done:
+		case <-tcpRxConn.wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// ReconnectPolicy decides what happens to the timeline when the connection
+// is re-established, see TcpRxConn.SetReconnect.
+type ReconnectPolicy int
+
+const (
+	// Start a new timeline with the first frame after reconnecting. Use
+	// this when the sender may have restarted its frame ids.
+	ReconnectReset ReconnectPolicy = iota
+	// Carry on with the timeline, treating the outage like lost frames.
+	ReconnectResume
+)
+
+// SetReconnectPolicy chooses how the timeline continues after the
+// connection reconnects. The default is ReconnectReset.
+func (r *RxIsochronous) SetReconnectPolicy(policy ReconnectPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reconnectPolicy = policy
+}
+
+func (r *RxIsochronous) reconnected() {
+	if debug {
+		log.Printf("Reconnected, policy %d", r.reconnectPolicy)
+	}
+	if r.reconnectPolicy == ReconnectReset && r.hasTimeline() {
+		r.clearTimeline()
+		r.setState(StateWaiting)
+	}
+}
@@ -0,0 +1,283 @@
+package streamcast
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A port nothing listens on.
+func freeTcpPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestTcpReconnect(t *testing.T) {
+	tx, err := NewTcpTx("127.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := tcpTxPort(tx)
+	conn, err := NewTcpRxConn("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReconnect(5*time.Millisecond, 20*time.Millisecond)
+	var mu sync.Mutex
+	var states []ConnState
+	conn.OnConnState(func(state ConnState, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	})
+	seen := func(state ConnState) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, s := range states {
+			if s == state {
+				return true
+			}
+		}
+		return false
+	}
+	rx, err := InitRxIsochronous(conn, time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+
+	// Keep sending until a frame arrives, clients join asynchronously.
+	readFrom := func(tx *TcpTx) *Frame {
+		t.Helper()
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(5 * time.Millisecond):
+					f := makeFrame(7)
+					tx.Write(f.Metadata, f.Data)
+				}
+			}
+		}()
+		for {
+			f, err := rx.Read()
+			if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f
+		}
+	}
+	if f := readFrom(tx); f.FrameId < 1 {
+		t.Fatalf("Unexpected frame %d", f.FrameId)
+	}
+
+	// Restart the server once the receiver has noticed it went away. Its
+	// frame ids start over.
+	tx.Close()
+	for start := time.Now(); !seen(ConnDisconnected); {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Server going away not noticed")
+		}
+		rx.Read()
+	}
+	tx, err = NewTcpTx("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	readFrom(tx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if states[0] != ConnConnected || states[1] != ConnDisconnected || states[len(states)-1] != ConnConnected {
+		t.Fatalf("Unexpected state changes %v", states)
+	}
+	if rx.Stats().Received == 0 {
+		t.Fatalf("No frames counted")
+	}
+}
+
+// Forward connections to target, each only after delay, which holds up a
+// TLS handshake through it. drop cuts every forwarded connection.
+func slowProxy(t *testing.T, target string, delay time.Duration) (port int, drop func()) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var mu sync.Mutex
+	var conns []net.Conn
+	track := func(c net.Conn) {
+		mu.Lock()
+		defer mu.Unlock()
+		conns = append(conns, c)
+	}
+	drop = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+		conns = nil
+	}
+	t.Cleanup(drop)
+	go func() {
+		for {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			track(client)
+			go func() {
+				time.Sleep(delay)
+				server, err := net.Dial("tcp", target)
+				if err != nil {
+					client.Close()
+					return
+				}
+				track(server)
+				go io.Copy(server, client)
+				io.Copy(client, server)
+				client.Close()
+				server.Close()
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, drop
+}
+
+// With concealment the timeline keeps running through an outage, so every
+// read has a deadline far shorter than the handshake. Reconnecting must not
+// be bound by it.
+func TestTcpReconnectSlowHandshake(t *testing.T) {
+	cert := issueCert(t, "server", nil, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	tx, err := NewTlsTcpTx("127.0.0.1", 0, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	port, drop := slowProxy(t, tx.tcpServer.listener.Addr().String(), 200*time.Millisecond)
+
+	conn, err := NewTcpRxConn("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetTLSConfig(&tls.Config{RootCAs: pool})
+	conn.SetReconnect(5*time.Millisecond, 20*time.Millisecond)
+	var mu sync.Mutex
+	connects := 0
+	conn.OnConnState(func(state ConnState, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if state == ConnConnected {
+			connects++
+		}
+	})
+	rx, err := InitRxIsochronous(conn, time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+	rx.SetConcealment(ConcealRepeat)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				f := makeFrame(7)
+				tx.Write(f.Metadata, f.Data)
+			}
+		}
+	}()
+	readUntil := func(done func() bool) {
+		t.Helper()
+		for start := time.Now(); !done(); rx.Read() {
+			if time.Since(start) > 3*time.Second {
+				t.Fatalf("Gave up waiting")
+			}
+		}
+	}
+	received := func() bool { return rx.Stats().Received > 0 }
+	readUntil(received)
+
+	drop()
+	readUntil(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return connects >= 2
+	})
+}
+
+func TestTcpReconnectClose(t *testing.T) {
+	conn, err := NewTcpRxConn("127.0.0.1", freeTcpPort(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReconnect(time.Hour, time.Hour)
+	// Nothing is listening, Reset defers to Read.
+	if err = conn.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := conn.Read(make([]byte, MAX_FRAME_LENGTH))
+		done <- err
+	}()
+	conn.Close()
+	select {
+	case err = <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("Expected closed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Close did not interrupt reconnect")
+	}
+	if err = conn.Reset(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Reset after Close returned %v", err)
+	}
+}
+
+func TestReconnectPolicy(t *testing.T) {
+	for _, policy := range []ReconnectPolicy{ReconnectReset, ReconnectResume} {
+		rx, conn, _ := fakeIsoc(t, time.Millisecond, 10*time.Millisecond)
+		rx.SetReconnectPolicy(policy)
+		conn.push(1)
+		expectFrame(t, rx, 1)
+
+		// A restarted sender starts over at frame 1.
+		conn.errs <- ErrReconnected
+		restarted := makeFrame(100)
+		restarted.FrameId = 1
+		conn.pushFrame(&restarted)
+		conn.push(2)
+		if policy == ReconnectReset {
+			expectFrame(t, rx, 100)
+		} else {
+			// Frame 1 was already delivered on the resumed timeline.
+			expectFrame(t, rx, 2)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package streamcast
+
+import (
+	"log"
+)
+
+// ResyncStrategy selects how RxIsochronous recovers its timeline after a
+// frame misses its deadline.
+type ResyncStrategy int
+
+const (
+	// ResyncReset when concealment is ConcealError, ResyncSkip otherwise.
+	ResyncDefault ResyncStrategy = iota
+	// Discard timing and wait for a new first frame.
+	ResyncReset
+	// Give up on the missing frame and continue on the existing timeline.
+	ResyncSkip
+	// Continue at the oldest frame already in the cache, skipping if empty.
+	ResyncJumpToOldest
+)
+
+// SetResync selects the recovery strategy after a missed frame. If
+// maxSkips is non-zero, more than maxSkips consecutive missed frames
+// force a full reset regardless of strategy.
+func (r *RxIsochronous) SetResync(strategy ResyncStrategy, maxSkips int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resync = strategy
+	r.maxSkips = maxSkips
+}
+
+func (r *RxIsochronous) resyncStrategy() ResyncStrategy {
+	if r.resync != ResyncDefault {
+		return r.resync
+	}
+	if r.concealment == ConcealError {
+		return ResyncReset
+	}
+	return ResyncSkip
+}
+
+// Move the timeline past the missing next frame.
+func (r *RxIsochronous) resynchronize() {
+	strategy := r.resyncStrategy()
+	r.skips++
+	if r.maxSkips > 0 && r.skips > r.maxSkips {
+		if debug {
+			log.Printf("%d consecutive missed frames, resetting", r.skips)
+		}
+		strategy = ResyncReset
+	}
+
+	switch strategy {
+	case ResyncSkip:
+		r.stats.Lost++
+		r.nextFrameId++
+	case ResyncJumpToOldest:
+		if oldest := r.cache.Oldest(); oldest != nil {
+			if debug {
+				log.Printf("Jumping from %d to cached %d", r.nextFrameId, oldest.FrameId)
+			}
+			r.stats.Lost += uint64(oldest.FrameId - r.nextFrameId)
+			r.nextFrameId = oldest.FrameId
+		} else {
+			r.stats.Lost++
+			r.nextFrameId++
+		}
+	default:
+		r.stats.Lost++
+		r.underrun()
+	}
+}
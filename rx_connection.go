@@ -1,7 +1,14 @@
 package streamcast
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,15 +20,108 @@ type RxConn interface {
 	SetDeadline(t time.Time) error
 }
 
+// SourceRxConn is implemented by connections that know the sender of each
+// packet. RxIsochronous uses it to fill in Frame.Source.
+type SourceRxConn interface {
+	RxConn
+	ReadFrom(b []byte) (int, net.Addr, error)
+}
+
 /* UDP Receiver Connection: mapping the generic methods above to UDP specific methods. */
 type UdpRxConn struct {
-	conn *net.UDPConn
-	addr *net.UDPAddr
+	mu         sync.Mutex
+	protocol   string
+	conn       *net.UDPConn
+	addr       *net.UDPAddr
+	lockSender bool
+	sender     *net.UDPAddr
+	allowed    []*net.IPNet
+	rejected   atomic.Uint64
+	group      net.IP
+	sources    []net.IP
+	ifi        *net.Interface
+	broadcast  bool
+}
+
+// NewUdpRxConn resolves the local address to listen on. The socket is
+// opened by Reset, which InitRxIsochronous calls.
+func NewUdpRxConn(network string, port int) (c *UdpRxConn, err error) {
+	return newUdpRxConn("udp", network, port)
+}
+
+// protocol is "udp", or "udp4" or "udp6" to restrict the address family.
+func newUdpRxConn(protocol string, network string, port int) (c *UdpRxConn, err error) {
+	c = new(UdpRxConn)
+	c.protocol = protocol
+	c.addr, err = net.ResolveUDPAddr(protocol, net.JoinHostPort(network, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// SetLockToFirstSender accepts packets only from the address of the first
+// packet received after Reset, rejecting every other sender.
+func (udpRxConn *UdpRxConn) SetLockToFirstSender(enabled bool) {
+	udpRxConn.mu.Lock()
+	defer udpRxConn.mu.Unlock()
+	udpRxConn.lockSender = enabled
+	udpRxConn.sender = nil
+}
+
+// SetAllowedSources accepts packets only from the given IP addresses or
+// CIDR ranges. No sources accepts everyone.
+func (udpRxConn *UdpRxConn) SetAllowedSources(sources ...string) (err error) {
+	var allowed []*net.IPNet
+	for _, source := range sources {
+		_, ipNet, err := net.ParseCIDR(source)
+		if err != nil {
+			ip := net.ParseIP(source)
+			if ip == nil {
+				return fmt.Errorf("Invalid source address: %s", source)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		allowed = append(allowed, ipNet)
+	}
+	udpRxConn.mu.Lock()
+	defer udpRxConn.mu.Unlock()
+	udpRxConn.allowed = allowed
+	return
+}
+
+// Sender returns the locked sender, nil if none is locked yet.
+func (udpRxConn *UdpRxConn) Sender() net.Addr {
+	udpRxConn.mu.Lock()
+	defer udpRxConn.mu.Unlock()
+	if udpRxConn.sender == nil {
+		return nil
+	}
+	return udpRxConn.sender
+}
+
+// Rejected returns the number of packets dropped by the source filters.
+func (udpRxConn *UdpRxConn) Rejected() uint64 {
+	return udpRxConn.rejected.Load()
 }
 
+// Reset reopens the socket and forgets the locked sender.
 func (udpRxConn *UdpRxConn) Reset() (err error) {
-	udpRxConn.Close()
-	udpRxConn.conn, err = net.ListenUDP("udp4", udpRxConn.addr)
+	udpRxConn.mu.Lock()
+	defer udpRxConn.mu.Unlock()
+	udpRxConn.close()
+	udpRxConn.sender = nil
+	if udpRxConn.group != nil {
+		udpRxConn.conn, err = udpRxConn.listenMulticast()
+	} else if udpRxConn.broadcast {
+		udpRxConn.conn, err = udpRxConn.listenBroadcast()
+	} else {
+		udpRxConn.conn, err = net.ListenUDP(udpRxConn.protocol, udpRxConn.addr)
+	}
 	if err != nil {
 		return err
 	}
@@ -29,46 +129,258 @@ func (udpRxConn *UdpRxConn) Reset() (err error) {
 }
 
 func (udpRxConn *UdpRxConn) SetDeadline(t time.Time) error {
-	return udpRxConn.conn.SetDeadline(t)
+	conn := udpRxConn.current()
+	if conn == nil {
+		return net.ErrClosed
+	}
+	return conn.SetDeadline(t)
 }
 
 func (udpRxConn *UdpRxConn) Close() {
+	udpRxConn.mu.Lock()
+	defer udpRxConn.mu.Unlock()
+	udpRxConn.close()
+}
+
+func (udpRxConn *UdpRxConn) close() {
 	if udpRxConn.conn != nil {
 		udpRxConn.conn.Close()
 	}
 }
 
 func (udpRxConn *UdpRxConn) Read(b []byte) (int, error) {
-	n, _, err := udpRxConn.conn.ReadFromUDP(b)
+	n, _, err := udpRxConn.ReadFrom(b)
 	return n, err
 }
 
+// ReadFrom reads the next packet that passes the source filters.
+func (udpRxConn *UdpRxConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	conn := udpRxConn.current()
+	if conn == nil {
+		return 0, nil, net.ErrClosed
+	}
+	for {
+		n, addr, err := conn.ReadFromUDP(b)
+		if err != nil {
+			return n, nil, err
+		}
+		if udpRxConn.accept(addr) {
+			return n, addr, nil
+		}
+		udpRxConn.rejected.Add(1)
+		if debug {
+			log.Printf("Rejected packet from %s", addr)
+		}
+	}
+}
+
+func (udpRxConn *UdpRxConn) accept(addr *net.UDPAddr) bool {
+	udpRxConn.mu.Lock()
+	defer udpRxConn.mu.Unlock()
+	if len(udpRxConn.allowed) > 0 {
+		allowed := false
+		for _, ipNet := range udpRxConn.allowed {
+			if ipNet.Contains(addr.IP) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	if udpRxConn.lockSender {
+		if udpRxConn.sender == nil {
+			udpRxConn.sender = addr
+		}
+		return udpRxConn.sender.IP.Equal(addr.IP) && udpRxConn.sender.Port == addr.Port
+	}
+	return true
+}
+
+// The connection is swapped by Reset, so callers take a reference under the
+// lock and use it outside.
+func (udpRxConn *UdpRxConn) current() *net.UDPConn {
+	udpRxConn.mu.Lock()
+	defer udpRxConn.mu.Unlock()
+	return udpRxConn.conn
+}
+
 /* TCP Receiver Connection: mapping the generic methods above to TCP specific methods. */
 type TcpRxConn struct {
-	conn *net.TCPConn
-	addr *net.TCPAddr
+	mu       sync.Mutex
+	protocol string
+	conn     net.Conn
+	framer   *streamFramer
+	host     string
+	addr     *net.TCPAddr
+	tls      *tls.Config
+	deadline time.Time
+	closed   bool
+	// Signalled by Close and SetDeadline to interrupt a reconnect backoff.
+	wake chan struct{}
+
+	reconnectMin time.Duration
+	reconnectMax time.Duration
+	broken       bool
+	backoff      time.Duration
+	nextAttempt  time.Time
+	cancelDial   context.CancelFunc
+	pending      *pendingDial
+	connState    ConnStateFunc
+}
+
+// NewTcpRxConn resolves the server address to connect to. The connection is
+// opened by Reset, which InitRxIsochronous calls.
+func NewTcpRxConn(network string, port int) (c *TcpRxConn, err error) {
+	return newTcpRxConn("tcp", network, port)
+}
+
+// protocol is "tcp", or "tcp4" or "tcp6" to restrict the address family.
+func newTcpRxConn(protocol string, network string, port int) (c *TcpRxConn, err error) {
+	c = new(TcpRxConn)
+	c.protocol = protocol
+	c.host = network
+	c.wake = make(chan struct{}, 1)
+	c.addr, err = net.ResolveTCPAddr(protocol, net.JoinHostPort(network, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return
 }
 
+// Reset connects to the server. With reconnect enabled a failure is not
+// returned; the connection is retried by Read instead. Fails with
+// net.ErrClosed after Close.
 func (tcpRxConn *TcpRxConn) Reset() (err error) {
-	tcpRxConn.Close()
-	tcpRxConn.conn, err = net.DialTCP("tcp4", nil, tcpRxConn.addr)
+	tcpRxConn.mu.Lock()
+	if tcpRxConn.closed {
+		tcpRxConn.mu.Unlock()
+		return net.ErrClosed
+	}
+	tcpRxConn.close()
+	tcpRxConn.abandonDial()
+	tcpRxConn.conn = nil
+	tcpRxConn.broken = false
+	tcpRxConn.backoff = 0
+	tcpRxConn.nextAttempt = time.Time{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tcpRxConn.cancelDial = cancel
+	tcpRxConn.mu.Unlock()
+
+	conn, err := tcpRxConn.dial(ctx)
+	tcpRxConn.mu.Lock()
+	tcpRxConn.cancelDial = nil
+	if err == nil {
+		err = tcpRxConn.connected(conn)
+	} else if tcpRxConn.reconnectMin > 0 {
+		tcpRxConn.retryLater()
+		tcpRxConn.mu.Unlock()
+		tcpRxConn.notify(ConnRetrying, err)
+		return nil
+	}
+	tcpRxConn.mu.Unlock()
 	if err != nil {
 		return err
 	}
+	tcpRxConn.notify(ConnConnected, nil)
 	return
 }
 
+// Dial the server, including the TLS handshake if configured, giving up
+// after tcpDialTimeout or when ctx is cancelled.
+func (tcpRxConn *TcpRxConn) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: tcpDialTimeout}
+	if config := tcpRxConn.tlsConfig(); config != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: config}
+		return tlsDialer.DialContext(ctx, tcpRxConn.protocol, tcpRxConn.addr.String())
+	}
+	return dialer.DialContext(ctx, tcpRxConn.protocol, tcpRxConn.addr.String())
+}
+
+// Install a new connection. Must be called with tcpRxConn.mu held.
+func (tcpRxConn *TcpRxConn) connected(conn net.Conn) error {
+	if tcpRxConn.closed {
+		conn.Close()
+		return net.ErrClosed
+	}
+	tcpRxConn.conn = conn
+	tcpRxConn.framer = newStreamFramer(conn)
+	tcpRxConn.broken = false
+	tcpRxConn.backoff = 0
+	return conn.SetDeadline(tcpRxConn.deadline)
+}
+
 func (tcpRxConn *TcpRxConn) SetDeadline(t time.Time) error {
-	return tcpRxConn.conn.SetDeadline(t)
+	tcpRxConn.mu.Lock()
+	tcpRxConn.deadline = t
+	conn, closed := tcpRxConn.conn, tcpRxConn.closed
+	tcpRxConn.mu.Unlock()
+	tcpRxConn.interrupt()
+	if closed {
+		return net.ErrClosed
+	}
+	if conn == nil {
+		// Reconnecting, applied to the next connection.
+		return nil
+	}
+	return conn.SetDeadline(t)
 }
 
+// Close is final, the connection cannot be Reset afterwards.
 func (tcpRxConn *TcpRxConn) Close() {
+	tcpRxConn.mu.Lock()
+	tcpRxConn.closed = true
+	tcpRxConn.close()
+	if tcpRxConn.cancelDial != nil {
+		tcpRxConn.cancelDial()
+	}
+	tcpRxConn.abandonDial()
+	tcpRxConn.mu.Unlock()
+	tcpRxConn.interrupt()
+}
+
+func (tcpRxConn *TcpRxConn) close() {
 	if tcpRxConn.conn != nil {
 		tcpRxConn.conn.Close()
 	}
 }
 
+func (tcpRxConn *TcpRxConn) interrupt() {
+	select {
+	case tcpRxConn.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Read reads one frame from the stream.
 func (tcpRxConn *TcpRxConn) Read(b []byte) (int, error) {
-	n, err := tcpRxConn.conn.Read(b)
+	n, _, err := tcpRxConn.ReadFrom(b)
 	return n, err
 }
+
+// ReadFrom reads like Read, reporting the server as the source. With
+// reconnect enabled a lost connection is re-established here, see
+// SetReconnect.
+func (tcpRxConn *TcpRxConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		tcpRxConn.mu.Lock()
+		conn, framer := tcpRxConn.conn, tcpRxConn.framer
+		closed, broken := tcpRxConn.closed, tcpRxConn.broken
+		tcpRxConn.mu.Unlock()
+		if closed || (conn == nil && !broken) {
+			return 0, nil, net.ErrClosed
+		}
+		if broken {
+			return 0, nil, tcpRxConn.reconnect()
+		}
+
+		n, err := framer.Read(b)
+		if err != nil && tcpRxConn.lost(conn, err) {
+			tcpRxConn.notify(ConnDisconnected, err)
+			continue
+		}
+		return n, conn.RemoteAddr(), err
+	}
+}
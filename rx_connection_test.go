@@ -0,0 +1,110 @@
+package streamcast
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func sendFrom(t *testing.T, from string, to int, id uint32) {
+	t.Helper()
+	f := makeFrame(id)
+	sendFrameFrom(t, from, to, &f)
+}
+
+func sendFrameFrom(t *testing.T, from string, to int, f *Frame) {
+	t.Helper()
+	laddr, err := net.ResolveUDPAddr("udp", from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialUDP("udp", laddr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var b [MAX_FRAME_LENGTH]byte
+	n, err := f.Write(b[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(b[:n]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFrom(t *testing.T, conn SourceRxConn) (*Frame, net.Addr) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	var b [MAX_FRAME_LENGTH]byte
+	n, addr, err := conn.ReadFrom(b[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := new(Frame)
+	if err = f.Read(b[:n]); err != nil {
+		t.Fatal(err)
+	}
+	return f, addr
+}
+
+func TestUdpLockToFirstSender(t *testing.T) {
+	conn, err := NewUdpRxConn("127.0.0.1", 8890)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetLockToFirstSender(true)
+	if err = conn.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sendFrom(t, "127.0.0.1:8891", 8890, 1)
+	sendFrom(t, "127.0.0.1:8892", 8890, 2)
+	sendFrom(t, "127.0.0.1:8891", 8890, 3)
+
+	for _, expected := range []uint32{1, 3} {
+		f, addr := readFrom(t, conn)
+		if f.FrameId != expected || addr.String() != "127.0.0.1:8891" {
+			t.Fatalf("Received frame %d from %v, expected %d", f.FrameId, addr, expected)
+		}
+	}
+	if conn.Sender().String() != "127.0.0.1:8891" {
+		t.Fatalf("Locked onto %v", conn.Sender())
+	}
+	if conn.Rejected() != 1 {
+		t.Fatalf("Rejected %d, expected 1", conn.Rejected())
+	}
+}
+
+func TestUdpAllowedSources(t *testing.T) {
+	conn, err := NewUdpRxConn("127.0.0.1", 8890)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.SetAllowedSources("bogus"); err == nil {
+		t.Fatalf("Expected error for invalid source")
+	}
+	if err = conn.SetAllowedSources("10.0.0.0/8", "127.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	rx, err := InitRxIsochronous(conn, time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+
+	sendFrom(t, "127.0.0.1:0", 8890, 1)
+	sendFrom(t, "127.0.0.2:0", 8890, 2)
+
+	f, err := rx.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FrameId != 2 || f.Source.(*net.UDPAddr).IP.String() != "127.0.0.2" {
+		t.Fatalf("Received frame %d from %v", f.FrameId, f.Source)
+	}
+	if conn.Rejected() != 1 {
+		t.Fatalf("Rejected %d, expected 1", conn.Rejected())
+	}
+}
@@ -1,10 +1,12 @@
 package streamcast
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -14,36 +16,75 @@ func (e *rxTimeout) Error() string   { return "rx timeout" }
 func (e *rxTimeout) Timeout() bool   { return true }
 func (e *rxTimeout) Temporary() bool { return true }
 
+// ErrInvalidFrame wraps the error for a packet that could not be parsed.
+// Only that packet is lost; reading may continue.
+var ErrInvalidFrame = errors.New("Invalid frame")
+
 // Desired behavior:
-// 1. On first received frame, wait for max_latency to establish read buffer. Return frame.
-// 2. On subsequent received frames, return immediately.
+// 1. On first received frame, wait for the pre-roll to establish read buffer. Return frame.
+// 2. On subsequent received frames, return at their release time (immediately without pre-roll).
 // 3. If "next" frame not received by deadline. Error
 // 4.
 // - Receive a certain number of frames per second, with a max latency
 // - If frames do not arrive by deadline drop and move to next
 
+// RxIsochronous is safe for concurrent use: state may be queried and
+// reconfigured while another goroutine is blocked in Read, and Close may be
+// called to interrupt it. Concurrent Reads are serialized.
 type RxIsochronous struct {
-	conn        RxConn
-	cache       *FrameCache
-	framePeriod time.Duration
-	buffer      time.Duration
-	baseTime    time.Time
-	baseFrameId uint32
-	nextFrameId uint32
+	mu               sync.Mutex
+	readMu           sync.Mutex
+	conn             RxConn
+	cache            *FrameCache
+	clock            Clock
+	framePeriod      time.Duration
+	buffer           time.Duration
+	baseTime         time.Time
+	baseFrameId      uint32
+	nextFrameId      uint32
+	lastFrame        *Frame
+	concealment      ConcealmentPolicy
+	concealFunc      ConcealFunc
+	resync           ResyncStrategy
+	maxSkips         int
+	skips            int
+	latePolicy       LatePolicy
+	late             chan *Frame
+	delivered        [deliveredHistory]uint64
+	state            RxState
+	stateFuncs       []StateChangeFunc
+	transitions      []stateChange
+	preroll          time.Duration
+	prerollDepth     int
+	vfr              bool
+	baseStamp        time.Time
+	lastRelease      time.Time
+	periodSamples    []periodSample
+	catchUpThreshold time.Duration
+	discardable      DiscardableFunc
+	stats            RxStats
+	jitter           time.Duration
+	hasArrival       bool
+	highestId        uint32
+	prevArrival      time.Time
+	prevSent         time.Duration
+	reconnectPolicy  ReconnectPolicy
 }
 
+// A zero framePeriod is detected from the incoming stream, see FramePeriod.
+// For the "unix" and "unixgram" protocols network is the socket path and
+// port is ignored.
 func NewRxIsochronous(protocol string, network string, port int, framePeriod time.Duration, buffer time.Duration) (r *RxIsochronous, err error) {
 	var conn RxConn
-	netPort := fmt.Sprintf("%s:%d", network, port)
 	switch protocol {
-	case "tcp":
-		tcpConn := new(TcpRxConn)
-		tcpConn.addr, err = net.ResolveTCPAddr(protocol, netPort)
-		conn = tcpConn
-	case "udp":
-		udpConn := new(UdpRxConn)
-		udpConn.addr, err = net.ResolveUDPAddr(protocol, netPort)
-		conn = udpConn
+	case "tcp", "tcp4", "tcp6":
+		conn, err = newTcpRxConn(protocol, network, port)
+	case "udp", "udp4", "udp6":
+		conn, err = newUdpRxConn(protocol, network, port)
+	case "unix":
+		conn = NewUnixRxConn(network)
+	case "unixgram":
+		conn = NewUnixgramRxConn(network)
 	default:
 		err = errors.New(fmt.Sprintf("Unsupported Protocol: %s.", protocol))
 	}
@@ -56,6 +97,7 @@ func NewRxIsochronous(protocol string, network string, port int, framePeriod tim
 func InitRxIsochronous(rxConn RxConn, framePeriod time.Duration, buffer time.Duration) (r *RxIsochronous, err error) {
 	r = new(RxIsochronous)
 	r.conn = rxConn
+	r.clock = RealClock
 	err = r.Reset()
 	if err != nil {
 		return nil, err
@@ -64,80 +106,223 @@ func InitRxIsochronous(rxConn RxConn, framePeriod time.Duration, buffer time.Dur
 	r.framePeriod = framePeriod
 	r.buffer = buffer
 
-	// Give ourselves little extra buffer, because we'll reconcile exact max latency below.
-	windowSize := uint32(buffer/framePeriod) + 2
-	r.cache = NewFrameCache(windowSize)
+	r.resizeCache()
 	return
 }
 
+// Resizes in place, so frames already buffered survive reconfiguration.
+func (r *RxIsochronous) resizeCache() {
+	if r.cache == nil {
+		r.cache = NewFrameCache(r.windowSize())
+	} else {
+		r.cache.Resize(r.windowSize())
+	}
+	if r.vfr {
+		r.cache.SetTimeWindow(r.buffer + r.preroll + 2*r.framePeriod)
+	} else {
+		r.cache.SetTimeWindow(0)
+	}
+}
+
+func (r *RxIsochronous) windowSize() (windowSize uint32) {
+	if r.framePeriod == 0 {
+		// Period not detected yet, hold enough frames to measure it.
+		windowSize = detectCacheSize
+	} else {
+		// Give ourselves little extra buffer, because we'll reconcile exact max latency below.
+		frames := (r.buffer+r.preroll+r.catchUpThreshold)/r.framePeriod + 2
+		if frames > maxCacheGrowth {
+			frames = maxCacheGrowth
+		}
+		windowSize = uint32(frames)
+	}
+	if depth := uint32(r.prerollDepth) + 2; depth > windowSize {
+		windowSize = depth
+	}
+	return windowSize
+}
+
+// Conn returns the underlying connection, for transport specific
+// configuration such as UdpRxConn source filters.
+func (r *RxIsochronous) Conn() RxConn {
+	return r.conn
+}
+
 func (r *RxIsochronous) Reset() (err error) {
 	return r.conn.Reset()
 }
 
+// SetClock replaces the clock used for frame deadlines. The RxConn must
+// interpret deadlines against the same clock.
+func (r *RxIsochronous) SetClock(c Clock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clock = c
+}
+
 func (r *RxIsochronous) NextDeadlineFromNow() time.Time {
-	if r.baseTime.IsZero() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.hasTimeline() {
 		return time.Time{}
 	}
 
-	//Next frame expected time
-	nextTime := r.baseTime.Add(time.Duration(r.nextFrameId-r.baseFrameId) * r.framePeriod).Add(r.buffer)
-	//How much time till then
-	return nextTime
+	return r.releaseAt(r.nextFrameId, r.cache.Lookup(r.nextFrameId)).Add(r.buffer)
 }
 
-func (r *RxIsochronous) underrun() (err error) {
+// Earliest time frameId is released on the current timeline; its deadline
+// is one buffer later. f is the frame itself if it has been received.
+func (r *RxIsochronous) releaseAt(frameId uint32, f *Frame) time.Time {
+	if r.vfr {
+		return r.vfrReleaseAt(frameId, f)
+	}
+	offset := int64(int32(frameId - r.baseFrameId))
+	return r.baseTime.Add(time.Duration(offset) * r.framePeriod)
+}
+
+// Forget the timeline, the next frame received starts a new one.
+func (r *RxIsochronous) clearTimeline() {
 	r.baseFrameId = 0
 	r.nextFrameId = 0
 	r.baseTime = time.Time{}
+	r.skips = 0
+}
+
+func (r *RxIsochronous) underrun() {
+	r.clearTimeline()
+	r.stats.Underruns++
 	if debug {
 		log.Printf("Rx Underrun")
 	}
-	return new(rxTimeout)
+	r.setState(StateUnderrun)
+}
+
+// The next frame missed its deadline. Conceal it if the policy allows and
+// resynchronize the timeline.
+func (r *RxIsochronous) missed() (f *Frame, err error) {
+	if r.concealment != ConcealError {
+		if debug {
+			log.Printf("Concealing frame %d", r.nextFrameId)
+		}
+		f = r.conceal(r.nextFrameId)
+	}
+	r.resynchronize()
+	if f == nil {
+		return nil, new(rxTimeout)
+	}
+	return f, nil
+}
+
+func (r *RxIsochronous) deliver(f *Frame) *Frame {
+	r.lastRelease = r.releaseAt(f.FrameId, f)
+	r.nextFrameId++
+	r.skips = 0
+	r.lastFrame = f
+	r.markDelivered(f.FrameId)
+	r.stats.Delivered++
+	if r.state == StateBuffering {
+		r.setState(StatePlaying)
+	}
+	return f
 }
 
 func (r *RxIsochronous) Read() (f *Frame, err error) {
+	return r.ReadContext(context.Background())
+}
+
+// ReadContext is Read bound to ctx. The connection deadline is the earlier
+// of the frame deadline and the context deadline, and cancelling ctx
+// interrupts a blocked read. Returns ctx.Err() once the context is done.
+func (r *RxIsochronous) ReadContext(ctx context.Context) (f *Frame, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+	deadline := watchContext(ctx, r.conn.SetDeadline)
+	defer func() {
+		if ctxErr := deadline.Close(); ctxErr != nil && err != nil {
+			f, err = nil, ctxErr
+		}
+	}()
+
+	r.mu.Lock()
+	f, err = r.read(ctx, deadline)
+	r.mu.Unlock()
+	r.notifyStateChanges()
+	return f, err
+}
+
+// The read loop. Called with r.mu held, which is released while blocked on
+// the connection.
+func (r *RxIsochronous) read(ctx context.Context, deadline *contextDeadline) (f *Frame, err error) {
 	for {
-		if debug {
-			log.Printf("Trying frame %d\n", r.nextFrameId)
+		now := r.clock.Now()
+		if r.prerolling() && r.prerollDone(now) {
+			r.startPlayout(now)
 		}
 
-		// Check cache
-		f := r.cache.Get(r.nextFrameId)
-		if f != nil {
+		// Work out how long we can block on the connection.
+		var nextDeadline time.Time
+		if r.prerolling() {
+			// Past the pre-roll but still detecting: wait for more frames.
+			if end := r.baseTime.Add(r.preroll); r.preroll > 0 && now.Before(end) {
+				nextDeadline = end
+			}
+		} else if r.hasTimeline() {
+			r.catchUp()
 			if debug {
-				log.Printf("Found %d in cache", r.nextFrameId)
+				log.Printf("Trying frame %d\n", r.nextFrameId)
+			}
+			if f := r.cache.Peek(r.nextFrameId); f != nil {
+				release := r.releaseAt(r.nextFrameId, f)
+				if !r.paced() || !now.Before(release) {
+					if debug {
+						log.Printf("Found %d in cache", r.nextFrameId)
+					}
+					return r.deliver(r.cache.Get(r.nextFrameId)), nil
+				}
+				// Hold the frame until its release time.
+				nextDeadline = release
+			} else {
+				nextDeadline = r.releaseAt(r.nextFrameId, nil).Add(r.buffer)
+				if !now.Before(nextDeadline) {
+					if debug {
+						log.Printf("Tried to read after deadline!")
+					}
+					return r.missed()
+				}
 			}
-			r.nextFrameId++
-			return f, nil
 		}
-
-		// Set deadline
-		nextDeadline := r.NextDeadlineFromNow()
 		if debug {
 			if !nextDeadline.IsZero() {
-				log.Printf("Next deadline %d us from now", nextDeadline.Sub(time.Now())/time.Microsecond)
+				log.Printf("Next deadline %d us from now", nextDeadline.Sub(now)/time.Microsecond)
 			} else {
 				log.Printf("First read")
 			}
 		}
 
-		if !nextDeadline.IsZero() && nextDeadline.Before(time.Now()) {
-			if debug {
-				log.Printf("Tried to read after deadline!")
-			}
-			return nil, r.underrun()
-		}
-
-		r.conn.SetDeadline(nextDeadline)
+		deadline.SetDeadline(nextDeadline)
 
 		f = new(Frame)
 		var b [MAX_FRAME_LENGTH]byte
-		n, err := r.conn.Read(b[:])
+		r.mu.Unlock()
+		r.notifyStateChanges()
+		n, source, err := r.readPacket(b[:])
+		r.mu.Lock()
 
-		// Timeout, report buffer underrun
+		if errors.Is(err, ErrReconnected) {
+			r.reconnected()
+			continue
+		}
+
+		// Timeout, re-evaluate deadlines above
 		neterr, ok := err.(net.Error)
 		if ok && neterr.Timeout() {
-			return nil, r.underrun()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
 		}
 
 		// Misc error handling
@@ -145,46 +330,70 @@ func (r *RxIsochronous) Read() (f *Frame, err error) {
 			return nil, err
 		}
 		if n >= len(b) {
-			return nil, fmt.Errorf("Read overflow")
+			return nil, fmt.Errorf("%w: read overflow", ErrInvalidFrame)
 		}
 
 		// Parse frame from received data
-		if err = f.Read(b[:]); err != nil {
-			return nil, err
+		if err = f.Read(b[:n]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
 		}
+		f.Source = source
 		if debug {
 			log.Printf("Rx Frame %d\n", f.FrameId)
 		}
 
 		// Handle first frame: setup cache and timing
-		if r.baseFrameId == 0 {
+		if !r.hasTimeline() {
 			r.nextFrameId = f.FrameId
 			r.baseFrameId = f.FrameId
 			r.cache.FastForwardTo(f.FrameId)
-			r.baseTime = time.Now()
+			r.baseTime = r.clock.Now()
+			r.baseStamp = f.Timestamp
+			r.lastRelease = r.baseTime
+			r.setState(StateBuffering)
 		}
 
-		// If we've already seen this frame, discard it.
+		r.stats.Received++
+		arrival := r.clock.Now()
+
+		// If we've already passed this frame, it is late or a duplicate.
 		if f.FrameId < r.nextFrameId {
+			if r.wasDelivered(f.FrameId) {
+				r.stats.Duplicate++
+				continue
+			}
+			r.stats.Late++
+			r.recordArrival(f, arrival)
+			if r.handleLate(f, arrival) {
+				return f, nil
+			}
 			continue
 		}
 
-		// If we receive the current frame, return it.
-		if f.FrameId == r.nextFrameId {
-			r.nextFrameId++
-			if debug {
-				log.Printf("Returning frame %d", f.FrameId)
-			}
-			return f, nil
+		// Cache current and future frames, they are released above.
+		switch r.cache.Put(f) {
+		case PutDuplicate:
+			r.stats.Duplicate++
+			continue
+		case PutOutOfWindow:
+			r.stats.OutOfWindow++
+			continue
 		}
-
-		// If we receive a future frame, cache it
-		if f.FrameId > r.nextFrameId {
-			r.cache.Put(f)
+		r.recordArrival(f, arrival)
+		if r.framePeriod == 0 {
+			r.detectPeriod(f, r.clock.Now())
 		}
 	}
 }
 
+func (r *RxIsochronous) readPacket(b []byte) (int, net.Addr, error) {
+	if conn, ok := r.conn.(SourceRxConn); ok {
+		return conn.ReadFrom(b)
+	}
+	n, err := r.conn.Read(b)
+	return n, nil, err
+}
+
 func (r *RxIsochronous) Close() {
 	if r.conn != nil {
 		r.conn.Close()
@@ -1,7 +1,9 @@
 package streamcast
 
 import (
+	"context"
 	"net"
+	"sync"
 	"testing"
 	"time"
 )
@@ -67,6 +69,35 @@ func expectIsoc(t *testing.T, duplication int, period time.Duration, maxLatency
 	}
 }
 
+// Build a receiver driven by a fake clock and an in-memory connection.
+func fakeIsoc(t *testing.T, period time.Duration, maxLatency time.Duration) (*RxIsochronous, *pipeRxConn, *FakeClock) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	conn := newPipeRxConn(clock)
+	rx, err := InitRxIsochronous(conn, period, maxLatency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx.SetClock(clock)
+	return rx, conn, clock
+}
+
+func expectFrame(t *testing.T, rx *RxIsochronous, expectedRid uint32) {
+	t.Helper()
+	frame, err := rx.Read()
+	if expectedRid == TO {
+		if neterr, ok := err.(net.Error); !ok || !neterr.Timeout() {
+			t.Fatalf("Expected timeout, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actualRid := extractDataPayload(frame.Data); actualRid != expectedRid {
+		t.Fatalf("Expected payload %d got %d", expectedRid, actualRid)
+	}
+}
+
 func TestReceiveDuplicates(t *testing.T) {
 	expectIsoc(t,
 		1,                // duplication
@@ -127,13 +158,24 @@ func TestReceiveWithHighDuplication(t *testing.T) {
 }
 
 func TestReceiveWithTimeout(t *testing.T) {
-	// Out of order with small window. 6 will be dropped because out of window
-	expectIsoc(t,
-		1,                    // duplication
-		time.Microsecond,     // period
-		500*time.Microsecond, // max latency
-		[]Packet{p(1, 0), p(3, 600), p(4, 0), p(5, 0)},
-		[]uint32{1, TO, 3, 4, 5, TO})
+	rx, conn, clock := fakeIsoc(t, time.Microsecond, 500*time.Microsecond)
+
+	conn.push(1)
+	expectFrame(t, rx, 1)
+
+	// Frame 2 never arrives; 3 shows up after 2's deadline has passed.
+	clock.Advance(600 * time.Microsecond)
+	conn.push(3, 4, 5)
+	expectFrame(t, rx, TO)
+	expectFrame(t, rx, 3)
+	expectFrame(t, rx, 4)
+	expectFrame(t, rx, 5)
+
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(time.Millisecond)
+	}()
+	expectFrame(t, rx, TO)
 }
 
 func TestShouldReturn0DeadlineBeforeRead(t *testing.T) {
@@ -150,19 +192,13 @@ func TestShouldReturn0DeadlineBeforeRead(t *testing.T) {
 func TestShouldSetAppropriateDeadline(t *testing.T) {
 	period := 1 * time.Millisecond
 	latency := 2 * time.Millisecond
-	fudge := 100 * time.Microsecond
 
-	rx, err := NewRxIsochronous("udp", "127.0.0.1", 8888,
-		1*time.Millisecond, // period
-		2*time.Millisecond) // max latency
-	if err != nil {
-		t.Error(err)
-	}
-	sendIsoc(t, 1, []Packet{p(1, 0)})
-	rx.Read()
-	deadline := rx.NextDeadlineFromNow().Sub(time.Now())
+	rx, conn, clock := fakeIsoc(t, period, latency)
+	conn.push(1)
+	expectFrame(t, rx, 1)
+	deadline := rx.NextDeadlineFromNow().Sub(clock.Now())
 
-	if deadline > latency+period || deadline < (latency+period)-fudge {
+	if deadline != latency+period {
 		t.Errorf("deadline was %d", deadline)
 	}
 }
@@ -186,3 +222,539 @@ func TestTCP(t *testing.T) {
 		t.Errorf("Received incorrect frame")
 	}
 }
+
+func TestConcealRepeatKeepsTimeline(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetConcealment(ConcealRepeat)
+
+	conn.push(1)
+	expectFrame(t, rx, 1)
+
+	// Frame 2 is lost; 3 arrives on time for its own slot.
+	clock.Advance(2500 * time.Microsecond)
+	conn.push(3)
+	f, err := rx.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Synthesized || f.FrameId != 2 || extractDataPayload(f.Data) != 1 {
+		t.Fatalf("Expected repeat of frame 1 as 2, got %+v", f)
+	}
+	expectFrame(t, rx, 3)
+}
+
+func TestConcealSilenceAndCallback(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetConcealment(ConcealSilence)
+
+	conn.push(1)
+	expectFrame(t, rx, 1)
+	clock.Advance(2500 * time.Microsecond)
+	f, err := rx.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Synthesized || f.FrameId != 2 || len(f.Data) != 4 || extractDataPayload(f.Data) != 0 {
+		t.Fatalf("Expected silence for frame 2, got %+v", f)
+	}
+
+	var concealed []uint32
+	rx.SetConcealFunc(func(frameId uint32, last *Frame) *Frame {
+		concealed = append(concealed, frameId)
+		f := makeFrame(frameId + 100)
+		return &f
+	})
+	clock.Advance(time.Millisecond)
+	expectFrame(t, rx, 103)
+	if len(concealed) != 1 || concealed[0] != 3 {
+		t.Fatalf("Callback saw %v", concealed)
+	}
+}
+
+func TestResyncSkipKeepsTimeline(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetResync(ResyncSkip, 0)
+
+	conn.push(1)
+	expectFrame(t, rx, 1)
+	clock.Advance(2500 * time.Microsecond)
+	conn.push(3)
+	expectFrame(t, rx, TO)
+	expectFrame(t, rx, 3)
+
+	// Frame 4 is still due on the original timeline, not one rebased on 3.
+	if deadline := rx.NextDeadlineFromNow(); !deadline.Equal(time.Unix(0, 0).Add(4 * time.Millisecond)) {
+		t.Errorf("deadline was %v", deadline)
+	}
+}
+
+func TestResyncJumpToOldest(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, 4*time.Millisecond)
+	rx.SetResync(ResyncJumpToOldest, 0)
+
+	conn.push(1, 4, 5)
+	expectFrame(t, rx, 1)
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(5500 * time.Microsecond)
+	}()
+	expectFrame(t, rx, TO)
+	expectFrame(t, rx, 4)
+	expectFrame(t, rx, 5)
+}
+
+func TestResyncMaxSkipsResets(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetResync(ResyncSkip, 1)
+
+	conn.push(1)
+	expectFrame(t, rx, 1)
+	clock.Advance(10 * time.Millisecond)
+	expectFrame(t, rx, TO)
+	if rx.NextDeadlineFromNow().IsZero() {
+		t.Fatalf("Timeline reset after a single skip")
+	}
+	expectFrame(t, rx, TO)
+	if !rx.NextDeadlineFromNow().IsZero() {
+		t.Fatalf("Timeline not reset after exceeding max skips")
+	}
+}
+
+func TestLateDeliveryInline(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetResync(ResyncSkip, 0)
+	rx.SetLateDelivery(LateInline)
+
+	conn.push(1)
+	expectFrame(t, rx, 1)
+	clock.Advance(2500 * time.Microsecond)
+	expectFrame(t, rx, TO)
+
+	// Duplicate of 1 is dropped, 2 is surfaced as late, 3 is on time.
+	conn.push(1, 2, 3)
+	f, err := rx.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FrameId != 2 || !f.Late || f.Lateness != 500*time.Microsecond {
+		t.Fatalf("Expected frame 2 late by 500us, got %+v", f)
+	}
+	expectFrame(t, rx, 3)
+}
+
+func TestLateDeliveryChannel(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetResync(ResyncSkip, 0)
+	rx.SetLateDelivery(LateChannel)
+
+	conn.push(1)
+	expectFrame(t, rx, 1)
+	clock.Advance(2500 * time.Microsecond)
+	expectFrame(t, rx, TO)
+
+	conn.push(2, 3)
+	expectFrame(t, rx, 3)
+	select {
+	case f := <-rx.Late():
+		if f.FrameId != 2 || !f.Late {
+			t.Fatalf("Expected late frame 2, got %+v", f)
+		}
+	default:
+		t.Fatalf("No late frame delivered")
+	}
+}
+
+func TestStateTransitions(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	var transitions []RxState
+	rx.OnStateChange(func(from RxState, to RxState) {
+		transitions = append(transitions, to)
+	})
+	if rx.State() != StateWaiting {
+		t.Fatalf("Initial state %v", rx.State())
+	}
+
+	// Frame id 0 is a legitimate first frame.
+	zero := makeFrame(100)
+	zero.FrameId = 0
+	conn.pushFrame(&zero)
+	conn.push(1, 2)
+	expectFrame(t, rx, 100)
+	expectFrame(t, rx, 1)
+	expectFrame(t, rx, 2)
+	clock.Advance(5 * time.Millisecond)
+	expectFrame(t, rx, TO)
+	conn.push(7)
+	expectFrame(t, rx, 7)
+
+	expected := []RxState{StateBuffering, StatePlaying, StateUnderrun, StateBuffering, StatePlaying}
+	if len(transitions) != len(expected) {
+		t.Fatalf("Transitions %v, expected %v", transitions, expected)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Fatalf("Transitions %v, expected %v", transitions, expected)
+		}
+	}
+}
+
+func TestPrerollHoldsFirstFrame(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetPreroll(3*time.Millisecond, 0)
+
+	conn.push(1, 2, 3)
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(3 * time.Millisecond)
+	}()
+	expectFrame(t, rx, 1)
+	if rx.State() != StatePlaying || !clock.Now().Equal(time.Unix(0, 0).Add(3*time.Millisecond)) {
+		t.Fatalf("Released in state %v at %v", rx.State(), clock.Now())
+	}
+
+	// Frame 2 is already cached but is paced out one period later.
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(time.Millisecond)
+	}()
+	expectFrame(t, rx, 2)
+	if !clock.Now().Equal(time.Unix(0, 0).Add(4 * time.Millisecond)) {
+		t.Fatalf("Frame 2 released at %v", clock.Now())
+	}
+}
+
+func TestPrerollDepth(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetPreroll(0, 2)
+
+	conn.push(1)
+	go conn.push(2)
+	expectFrame(t, rx, 1)
+	if rx.State() != StatePlaying {
+		t.Fatalf("State %v after pre-roll depth reached", rx.State())
+	}
+}
+
+func TestVariableFrameRateDeadlines(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, 10*time.Millisecond, time.Millisecond)
+	rx.SetVariableFrameRate(true)
+	rx.SetResync(ResyncSkip, 0)
+	start := time.Unix(1000, 0)
+	stamped := func(id uint32, at time.Duration) {
+		f := makeFrame(id)
+		f.Timestamp = start.Add(at)
+		conn.pushFrame(&f)
+	}
+
+	stamped(1, 0)
+	expectFrame(t, rx, 1)
+
+	// Nothing cached: the next frame may be up to one period away.
+	if deadline := rx.NextDeadlineFromNow(); !deadline.Equal(time.Unix(0, 0).Add(11 * time.Millisecond)) {
+		t.Fatalf("deadline was %v", deadline)
+	}
+
+	// Frame 3 at 4ms shows frame 2 must have been due before 5ms.
+	stamped(3, 4*time.Millisecond)
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(5 * time.Millisecond)
+	}()
+	expectFrame(t, rx, TO)
+	expectFrame(t, rx, 3)
+
+	stamped(4, 12*time.Millisecond)
+	expectFrame(t, rx, 4)
+	if deadline := rx.NextDeadlineFromNow(); !deadline.Equal(time.Unix(0, 0).Add(23 * time.Millisecond)) {
+		t.Fatalf("deadline was %v", deadline)
+	}
+}
+
+func TestFrameTimestampRoundTrip(t *testing.T) {
+	var b [MAX_FRAME_LENGTH]byte
+	in := makeFrame(7)
+	in.Timestamp = time.Unix(1234, 5678)
+	n, err := in.Write(b[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Frame
+	if err = out.Read(b[:n]); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Timestamp.Equal(in.Timestamp) || extractDataPayload(out.Data) != 7 {
+		t.Fatalf("Round trip mismatch %+v", out)
+	}
+}
+
+func TestAdvertisedFramePeriod(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, 0, time.Millisecond)
+	f := makeFrame(1)
+	f.Period = 5 * time.Millisecond
+	conn.pushFrame(&f)
+	expectFrame(t, rx, 1)
+	if rx.FramePeriod() != 5*time.Millisecond {
+		t.Fatalf("Period %v", rx.FramePeriod())
+	}
+	if deadline := rx.NextDeadlineFromNow(); !deadline.Equal(time.Unix(0, 0).Add(6 * time.Millisecond)) {
+		t.Fatalf("deadline was %v", deadline)
+	}
+}
+
+func TestInferredFramePeriod(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, 0, time.Millisecond)
+	start := time.Unix(1000, 0)
+	for i := uint32(1); i <= detectFrames; i++ {
+		f := makeFrame(i)
+		f.Timestamp = start.Add(time.Duration(i) * 4 * time.Millisecond)
+		conn.pushFrame(&f)
+	}
+	for i := uint32(1); i <= detectFrames; i++ {
+		expectFrame(t, rx, i)
+	}
+	if rx.FramePeriod() != 4*time.Millisecond {
+		t.Fatalf("Period %v", rx.FramePeriod())
+	}
+}
+
+// Wait for the receiver, blocked in Read on another goroutine, to have
+// taken in n frames.
+func waitForReceived(t *testing.T, rx *RxIsochronous, n uint64) {
+	t.Helper()
+	for start := time.Now(); rx.Stats().Received != n; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Received %d frames, expected %d", rx.Stats().Received, n)
+		}
+	}
+}
+
+func TestHostileFramePeriod(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, 0, time.Second)
+	done := make(chan error)
+	go func() {
+		_, err := rx.Read()
+		done <- err
+	}()
+	for i, period := range []time.Duration{time.Nanosecond, time.Hour} {
+		f := makeFrame(uint32(i + 1))
+		f.Period = period
+		conn.pushFrame(&f)
+	}
+	waitForReceived(t, rx, 2)
+	rx.mu.Lock()
+	size := rx.cache.cacheSize
+	rx.mu.Unlock()
+	if rx.FramePeriod() != 0 || size != detectCacheSize {
+		t.Fatalf("Accepted period %v, cache size %d", rx.FramePeriod(), size)
+	}
+
+	f := makeFrame(3)
+	f.Period = 5 * time.Millisecond
+	conn.pushFrame(&f)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if rx.FramePeriod() != 5*time.Millisecond {
+		t.Fatalf("Period %v", rx.FramePeriod())
+	}
+
+	// Even a valid period leaves the cache bounded.
+	rx, _, _ = fakeIsoc(t, minFramePeriod, time.Hour)
+	if rx.cache.cacheSize != maxCacheGrowth {
+		t.Fatalf("Cache size %d", rx.cache.cacheSize)
+	}
+}
+
+func TestZeroElapsedBurst(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, 0, time.Millisecond)
+	done := make(chan error)
+	go func() {
+		_, err := rx.Read()
+		done <- err
+	}()
+	stamp := time.Unix(1000, 0)
+	for i := uint32(1); i <= 4*detectFrames; i++ {
+		f := makeFrame(i)
+		f.Timestamp = stamp
+		conn.pushFrame(&f)
+	}
+	waitForReceived(t, rx, 4*detectFrames)
+	rx.mu.Lock()
+	samples := len(rx.periodSamples)
+	rx.mu.Unlock()
+	if rx.FramePeriod() != 0 || samples != detectFrames {
+		t.Fatalf("Period %v from %d samples", rx.FramePeriod(), samples)
+	}
+
+	f := makeFrame(4*detectFrames + 1)
+	f.Period = time.Millisecond
+	conn.pushFrame(&f)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatchUpDropsBurst(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetPreroll(2*time.Millisecond, 0)
+	rx.SetCatchUp(time.Millisecond, nil)
+
+	// A burst arrives during the 2ms pre-roll. The cache holds six frames,
+	// 5ms buffered against a 2ms target plus 1ms threshold.
+	conn.push(1, 2, 3, 4, 5, 6, 7, 8)
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(2 * time.Millisecond)
+	}()
+	expectFrame(t, rx, 3)
+	if rx.SkippedForLatency() != 2 {
+		t.Fatalf("Skipped %d frames", rx.SkippedForLatency())
+	}
+
+	// The rest follow one period apart.
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(time.Millisecond)
+	}()
+	expectFrame(t, rx, 4)
+}
+
+func TestCatchUpStopsAtKeyFrame(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	rx.SetPreroll(2*time.Millisecond, 0)
+	rx.SetCatchUp(time.Millisecond, func(f *Frame) bool {
+		return f.FrameId != 2
+	})
+
+	conn.push(1, 2, 3, 4, 5, 6, 7, 8)
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(2 * time.Millisecond)
+	}()
+	expectFrame(t, rx, 2)
+	if rx.SkippedForLatency() != 1 {
+		t.Fatalf("Skipped %d frames", rx.SkippedForLatency())
+	}
+}
+
+func TestReadContextCancel(t *testing.T) {
+	rx, _, _ := fakeIsoc(t, time.Millisecond, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := rx.ReadContext(ctx); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestReadContextDeadline(t *testing.T) {
+	rx, err := NewRxIsochronous("udp", "127.0.0.1", 8888, time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rx.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := rx.ReadContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestWriteContextCancelled(t *testing.T) {
+	tx, err := NewUdpTx("127.0.0.1", 8888, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tx.WriteContext(ctx, nil, []byte{1}); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// A cancellation racing the end of an operation must not move the deadline
+// once Close returned, or the next operation on the connection times out.
+func TestContextDeadlineCloseWaits(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var last time.Time
+	set := func(d time.Time) error {
+		if d == aLongTimeAgo {
+			close(entered)
+			<-release
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		last = d
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := watchContext(ctx, set)
+	cancel()
+	<-entered
+
+	closed := make(chan struct{})
+	go func() {
+		w.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatalf("Close returned while the callback was running")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+	mu.Lock()
+	defer mu.Unlock()
+	if last != aLongTimeAgo {
+		t.Fatalf("Deadline %v after Close", last)
+	}
+}
+
+func TestWriteWithFakeClock(t *testing.T) {
+	tx, err := NewUdpTx("127.0.0.1", 8888, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+	tx.SetClock(NewFakeClock(time.Unix(0, 0)))
+	tx.SetTimestamps(true)
+	if err = tx.Write(nil, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	rx, conn, clock := fakeIsoc(t, time.Millisecond, 4*time.Millisecond)
+	rx.SetResync(ResyncSkip, 0)
+
+	conn.push(1, 1, 3, 2, 20)
+	expectFrame(t, rx, 1)
+	expectFrame(t, rx, 2)
+	expectFrame(t, rx, 3)
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(10 * time.Millisecond)
+	}()
+	expectFrame(t, rx, TO)
+
+	s := rx.Stats()
+	expected := RxStats{Received: 5, Delivered: 3, Lost: 1, Duplicate: 1, Reordered: 1, OutOfWindow: 1}
+	s.Jitter = 0
+	if s != expected {
+		t.Fatalf("Stats %+v, expected %+v", s, expected)
+	}
+	if rx.Stats().Jitter == 0 {
+		t.Fatalf("Jitter not estimated")
+	}
+
+	rx.ResetStats()
+	if s := rx.Stats(); s != (RxStats{}) {
+		t.Fatalf("Stats not reset: %+v", s)
+	}
+}
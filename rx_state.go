@@ -0,0 +1,88 @@
+package streamcast
+
+import (
+	"log"
+)
+
+// RxState is the playout state of an RxIsochronous receiver.
+type RxState int
+
+const (
+	// No frame received yet.
+	StateWaiting RxState = iota
+	// Timeline established, building up the read buffer.
+	StateBuffering
+	// Releasing frames on the isochronous timeline.
+	StatePlaying
+	// A frame missed its deadline and timing was reset.
+	StateUnderrun
+)
+
+func (s RxState) String() string {
+	switch s {
+	case StateWaiting:
+		return "waiting"
+	case StateBuffering:
+		return "buffering"
+	case StatePlaying:
+		return "playing"
+	case StateUnderrun:
+		return "underrun"
+	}
+	return "unknown"
+}
+
+// StateChangeFunc is called with the previous and new state on every
+// transition. It runs on the goroutine calling Read and must not block.
+type StateChangeFunc func(from RxState, to RxState)
+
+type stateChange struct {
+	from RxState
+	to   RxState
+}
+
+func (r *RxIsochronous) State() RxState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+// OnStateChange subscribes fn to state transitions.
+func (r *RxIsochronous) OnStateChange(fn StateChangeFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stateFuncs = append(r.stateFuncs, fn)
+}
+
+// Must be called with r.mu held. Subscribers are notified later, without the
+// lock, by notifyStateChanges.
+func (r *RxIsochronous) setState(state RxState) {
+	if r.state == state {
+		return
+	}
+	from := r.state
+	r.state = state
+	if debug {
+		log.Printf("Rx state %v -> %v", from, state)
+	}
+	r.transitions = append(r.transitions, stateChange{from, state})
+}
+
+func (r *RxIsochronous) notifyStateChanges() {
+	r.mu.Lock()
+	transitions := r.transitions
+	funcs := r.stateFuncs
+	r.transitions = nil
+	r.mu.Unlock()
+
+	for _, t := range transitions {
+		for _, fn := range funcs {
+			fn(t.from, t.to)
+		}
+	}
+}
+
+// Whether a base frame and time have been established.
+func (r *RxIsochronous) hasTimeline() bool {
+	return r.state == StateBuffering || r.state == StatePlaying
+}
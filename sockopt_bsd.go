@@ -0,0 +1,28 @@
+//go:build unix && !linux
+
+package streamcast
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// The BSDs, like the other Unix systems, take a single byte for the IPv4
+// multicast TTL and loopback options.
+func setsockoptMulticast4(rc syscall.RawConn, opt int, value int) error {
+	return control(rc, func(fd int) error {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptByte(fd, syscall.IPPROTO_IP, opt, byte(value)))
+	})
+}
+
+// Choose the outgoing IPv4 interface by its address.
+func setMulticastInterface4(rc syscall.RawConn, ifi *net.Interface) error {
+	ifaddr, err := interfaceAddr4(ifi)
+	if err != nil {
+		return err
+	}
+	return control(rc, func(fd int) error {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptInet4Addr(fd, syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, [4]byte(ifaddr)))
+	})
+}
@@ -0,0 +1,92 @@
+//go:build linux
+
+package streamcast
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Linux values missing from package syscall.
+const (
+	mcastJoinSourceGroup  = 46
+	sizeofSockaddrStorage = 128
+)
+
+// Join group on ifi (nil for the default interface), as source-specific
+// membership when source is set.
+func joinGroup(rc syscall.RawConn, group net.IP, source net.IP, ifi *net.Interface) error {
+	if group.To4() == nil {
+		return joinGroup6(rc, group, source, ifi)
+	}
+	if source == nil {
+		mreq := &syscall.IPMreqn{Ifindex: int32(ifindex(ifi))}
+		copy(mreq.Multiaddr[:], group.To4())
+		return control(rc, func(fd int) error {
+			return os.NewSyscallError("setsockopt", syscall.SetsockoptIPMreqn(fd, syscall.IPPROTO_IP, syscall.IP_ADD_MEMBERSHIP, mreq))
+		})
+	}
+
+	// struct ip_mreq_source: group, interface address, source.
+	ifaddr, err := interfaceAddr4(ifi)
+	if err != nil {
+		return err
+	}
+	var mreq [3 * net.IPv4len]byte
+	copy(mreq[0:], group.To4())
+	copy(mreq[4:], ifaddr)
+	copy(mreq[8:], source.To4())
+	return control(rc, func(fd int) error {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptString(fd, syscall.IPPROTO_IP, syscall.IP_ADD_SOURCE_MEMBERSHIP, string(mreq[:])))
+	})
+}
+
+func joinGroup6(rc syscall.RawConn, group net.IP, source net.IP, ifi *net.Interface) error {
+	if source == nil {
+		mreq := &syscall.IPv6Mreq{Interface: uint32(ifindex(ifi))}
+		copy(mreq.Multiaddr[:], group.To16())
+		return control(rc, func(fd int) error {
+			return os.NewSyscallError("setsockopt", syscall.SetsockoptIPv6Mreq(fd, syscall.IPPROTO_IPV6, syscall.IPV6_JOIN_GROUP, mreq))
+		})
+	}
+
+	// struct group_source_req: interface index, then group and source as
+	// sockaddr_storage, which is aligned like a long.
+	var req groupSourceReq
+	binary.NativeEndian.PutUint32(req.iface[:], uint32(ifindex(ifi)))
+	putSockaddr6(req.group[:], group)
+	putSockaddr6(req.source[:], source)
+	b := (*[unsafe.Sizeof(req)]byte)(unsafe.Pointer(&req))[:]
+	return control(rc, func(fd int) error {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptString(fd, syscall.IPPROTO_IPV6, mcastJoinSourceGroup, string(b)))
+	})
+}
+
+type groupSourceReq struct {
+	iface  [4]byte
+	_      [unsafe.Alignof(uintptr(0)) - 4]byte
+	group  [sizeofSockaddrStorage]byte
+	source [sizeofSockaddrStorage]byte
+}
+
+// Write ip as a struct sockaddr_in6.
+func putSockaddr6(b []byte, ip net.IP) {
+	binary.NativeEndian.PutUint16(b[0:], syscall.AF_INET6)
+	copy(b[8:24], ip.To16())
+}
+
+// Linux takes an int for the IPv4 multicast TTL and loopback options.
+func setsockoptMulticast4(rc syscall.RawConn, opt int, value int) error {
+	return setsockoptInt(rc, syscall.IPPROTO_IP, opt, value)
+}
+
+// Choose the outgoing IPv4 interface by index.
+func setMulticastInterface4(rc syscall.RawConn, ifi *net.Interface) error {
+	mreq := &syscall.IPMreqn{Ifindex: int32(ifindex(ifi))}
+	return control(rc, func(fd int) error {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptIPMreqn(fd, syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, mreq))
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package streamcast
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var errSockoptUnsupported = errors.New("Socket option not supported on this platform")
+
+// Source-specific joins are only implemented on Linux.
+func joinGroup(rc syscall.RawConn, group net.IP, source net.IP, ifi *net.Interface) error {
+	return errSockoptUnsupported
+}
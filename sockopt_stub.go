@@ -0,0 +1,28 @@
+//go:build !unix && !windows
+
+package streamcast
+
+import (
+	"net"
+	"syscall"
+)
+
+func reuseAddr(network, address string, rc syscall.RawConn) error {
+	return nil
+}
+
+func setBroadcast(rc syscall.RawConn, enabled bool) error {
+	return errSockoptUnsupported
+}
+
+func setMulticastLoop(rc syscall.RawConn, v6 bool, enabled bool) error {
+	return errSockoptUnsupported
+}
+
+func setMulticastTTL(rc syscall.RawConn, v6 bool, ttl int) error {
+	return errSockoptUnsupported
+}
+
+func setMulticastInterface(rc syscall.RawConn, v6 bool, ifi *net.Interface) error {
+	return errSockoptUnsupported
+}
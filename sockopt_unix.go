@@ -0,0 +1,60 @@
+//go:build unix
+
+package streamcast
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// Run fn on the socket's file descriptor.
+func control(rc syscall.RawConn, fn func(fd int) error) (err error) {
+	if cerr := rc.Control(func(fd uintptr) { err = fn(int(fd)) }); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+func setsockoptInt(rc syscall.RawConn, level, opt, value int) error {
+	return control(rc, func(fd int) error {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(fd, level, opt, value))
+	})
+}
+
+func boolInt(enabled bool) int {
+	if enabled {
+		return 1
+	}
+	return 0
+}
+
+// Lets several receivers on the host bind the same port.
+func reuseAddr(network, address string, rc syscall.RawConn) error {
+	return setsockoptInt(rc, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+}
+
+func setBroadcast(rc syscall.RawConn, enabled bool) error {
+	return setsockoptInt(rc, syscall.SOL_SOCKET, syscall.SO_BROADCAST, boolInt(enabled))
+}
+
+func setMulticastLoop(rc syscall.RawConn, v6 bool, enabled bool) error {
+	if v6 {
+		return setsockoptInt(rc, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_LOOP, boolInt(enabled))
+	}
+	return setsockoptMulticast4(rc, syscall.IP_MULTICAST_LOOP, boolInt(enabled))
+}
+
+func setMulticastTTL(rc syscall.RawConn, v6 bool, ttl int) error {
+	if v6 {
+		return setsockoptInt(rc, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, ttl)
+	}
+	return setsockoptMulticast4(rc, syscall.IP_MULTICAST_TTL, ttl)
+}
+
+func setMulticastInterface(rc syscall.RawConn, v6 bool, ifi *net.Interface) error {
+	if v6 {
+		return setsockoptInt(rc, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, ifindex(ifi))
+	}
+	return setMulticastInterface4(rc, ifi)
+}
@@ -0,0 +1,65 @@
+//go:build windows
+
+package streamcast
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+func setsockoptInt(rc syscall.RawConn, level, opt, value int) (err error) {
+	if cerr := rc.Control(func(fd uintptr) {
+		err = os.NewSyscallError("setsockopt", syscall.SetsockoptInt(syscall.Handle(fd), level, opt, value))
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// Lets several receivers on the host bind the same port.
+func reuseAddr(network, address string, rc syscall.RawConn) error {
+	return setsockoptInt(rc, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+}
+
+func boolInt(enabled bool) int {
+	if enabled {
+		return 1
+	}
+	return 0
+}
+
+func setBroadcast(rc syscall.RawConn, enabled bool) error {
+	return setsockoptInt(rc, syscall.SOL_SOCKET, syscall.SO_BROADCAST, boolInt(enabled))
+}
+
+func setMulticastLoop(rc syscall.RawConn, v6 bool, enabled bool) error {
+	if v6 {
+		return setsockoptInt(rc, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_LOOP, boolInt(enabled))
+	}
+	return setsockoptInt(rc, syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, boolInt(enabled))
+}
+
+func setMulticastTTL(rc syscall.RawConn, v6 bool, ttl int) error {
+	if v6 {
+		return setsockoptInt(rc, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, ttl)
+	}
+	return setsockoptInt(rc, syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, ttl)
+}
+
+// IPv6 takes the interface index, IPv4 the interface address.
+func setMulticastInterface(rc syscall.RawConn, v6 bool, ifi *net.Interface) (err error) {
+	if v6 {
+		return setsockoptInt(rc, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, ifindex(ifi))
+	}
+	ifaddr, err := interfaceAddr4(ifi)
+	if err != nil {
+		return err
+	}
+	if cerr := rc.Control(func(fd uintptr) {
+		err = os.NewSyscallError("setsockopt", syscall.SetsockoptInet4Addr(syscall.Handle(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, [4]byte(ifaddr)))
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package streamcast
+
+import (
+	"time"
+)
+
+// frameStamper numbers the frames a Tx sends with Write and fills in the
+// optional header fields. Every Tx embeds one, which gives it SetClock,
+// SetTimestamps, SetNominalPeriod and SetSessionId.
+type frameStamper struct {
+	currentId uint32
+	clock     Clock
+	stamp     bool
+	period    time.Duration
+	session   uint32
+}
+
+func newFrameStamper() frameStamper {
+	return frameStamper{currentId: 1, clock: RealClock}
+}
+
+// The next frame to send, carrying metadata and data.
+func (s *frameStamper) next(metadata []byte, data []byte) (f Frame) {
+	f.Data = data
+	f.Metadata = metadata
+	f.FrameId = s.currentId
+	if s.stamp {
+		f.Timestamp = s.clock.Now()
+	}
+	f.Period = s.period
+	f.SessionId = s.session
+	s.currentId += 1
+	return f
+}
+
+// SetClock replaces the clock used for frame timestamps. Socket deadlines
+// always follow real time.
+func (s *frameStamper) SetClock(c Clock) {
+	s.clock = c
+}
+
+// SetTimestamps enables stamping frames sent with Write with the current time.
+func (s *frameStamper) SetTimestamps(enabled bool) {
+	s.stamp = enabled
+}
+
+// SetNominalPeriod advertises the frame period in every frame sent with
+// Write, so receivers can be started without knowing it.
+func (s *frameStamper) SetNominalPeriod(period time.Duration) {
+	s.period = period
+}
+
+// SetSessionId tags every frame sent with Write with id, so a receiver
+// demultiplexing several streams from one address can tell them apart.
+func (s *frameStamper) SetSessionId(id uint32) {
+	s.session = id
+}
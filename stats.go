@@ -0,0 +1,77 @@
+package streamcast
+
+import (
+	"time"
+)
+
+// RxStats is a snapshot of receiver counters.
+type RxStats struct {
+	// Frames parsed from the connection.
+	Received uint64
+	// Received frames returned from Read on their slot.
+	Delivered uint64
+	// Frames whose slot passed without them, concealed or not.
+	Lost uint64
+	// Frames received more than once.
+	Duplicate uint64
+	// Frames received after their slot had passed.
+	Late uint64
+	// Frames dropped because they were too far ahead of the timeline.
+	OutOfWindow uint64
+	// Frames received after a frame with a higher id.
+	Reordered uint64
+	// Timeline resets after missed frames.
+	Underruns uint64
+	// Frames dropped by catch-up, see SetCatchUp.
+	SkippedForLatency uint64
+	// Frames currently cached.
+	BufferDepth int
+	// RFC 3550 interarrival jitter estimate.
+	Jitter time.Duration
+}
+
+// Stats returns a snapshot of the receive counters.
+func (r *RxIsochronous) Stats() (s RxStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s = r.stats
+	s.BufferDepth = r.cache.Len()
+	s.Jitter = r.jitter
+	return s
+}
+
+// ResetStats zeroes the counters and jitter estimate.
+func (r *RxIsochronous) ResetStats() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = RxStats{}
+	r.jitter = 0
+	r.hasArrival = false
+}
+
+// Record the arrival of a new (non-duplicate) frame for the reordering
+// count and jitter estimate.
+func (r *RxIsochronous) recordArrival(f *Frame, arrival time.Time) {
+	if r.hasArrival && int32(f.FrameId-r.highestId) < 0 {
+		r.stats.Reordered++
+	}
+
+	// Sender clock: its timestamp if it sent one, else the nominal slot.
+	sent := time.Duration(f.FrameId) * r.framePeriod
+	if !f.Timestamp.IsZero() {
+		sent = time.Duration(f.Timestamp.UnixNano())
+	}
+	if r.hasArrival {
+		d := arrival.Sub(r.prevArrival) - (sent - r.prevSent)
+		if d < 0 {
+			d = -d
+		}
+		r.jitter += (d - r.jitter) / 16
+	}
+	if !r.hasArrival || int32(f.FrameId-r.highestId) > 0 {
+		r.highestId = f.FrameId
+	}
+	r.prevArrival = arrival
+	r.prevSent = sent
+	r.hasArrival = true
+}
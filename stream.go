@@ -0,0 +1,166 @@
+package streamcast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Byte streams are carried in frames whose metadata holds the stream offset
+// of the data (u64, big endian) followed by a flags byte. The stream ends
+// with an empty frame flagged streamEOF at the final offset.
+const (
+	streamHeaderLength = 9
+	// Room left for the frame header and extensions.
+	StreamChunkSize = MAX_FRAME_LENGTH - 8 - streamHeaderLength - 64
+
+	streamEOF uint8 = 1 << 0
+)
+
+// ErrStreamGap is returned by a StreamReader using GapError when stream
+// data was lost.
+var ErrStreamGap = errors.New("Stream gap")
+
+// StreamWriter is an io.Writer that chunks a byte stream into frames on a Tx.
+type StreamWriter struct {
+	tx     Tx
+	offset uint64
+}
+
+func NewStreamWriter(tx Tx) (w *StreamWriter) {
+	w = new(StreamWriter)
+	w.tx = tx
+	return w
+}
+
+func (w *StreamWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > StreamChunkSize {
+			chunk = chunk[:StreamChunkSize]
+		}
+		if err = w.tx.Write(w.header(0), chunk); err != nil {
+			return n, err
+		}
+		w.offset += uint64(len(chunk))
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Close marks the end of the stream. The Tx is left open.
+func (w *StreamWriter) Close() error {
+	return w.tx.Write(w.header(streamEOF), nil)
+}
+
+func (w *StreamWriter) header(flags uint8) []byte {
+	b := binary.BigEndian.AppendUint64(make([]byte, 0, streamHeaderLength), w.offset)
+	return append(b, flags)
+}
+
+type GapPolicy int
+
+const (
+	// Read fails with ErrStreamGap. Reading again continues after the gap.
+	GapError GapPolicy = iota
+	// Missing bytes are read as zeros, keeping offsets intact.
+	GapZeroFill
+	// Missing bytes are left out.
+	GapSkip
+)
+
+// StreamReader is an io.Reader reassembling a byte stream written by a
+// StreamWriter from the frames of a receiver. Frames lost on the way are
+// handled per the gap policy; duplicated or late data is dropped. A reader
+// joining a stream already under way starts at the first data it receives.
+type StreamReader struct {
+	rx      *RxIsochronous
+	policy  GapPolicy
+	started bool
+	offset  uint64
+	pending []byte
+	zeros   uint64
+	eof     bool
+}
+
+func NewStreamReader(rx *RxIsochronous) (r *StreamReader) {
+	r = new(StreamReader)
+	r.rx = rx
+	return r
+}
+
+func (r *StreamReader) SetGapPolicy(policy GapPolicy) {
+	r.policy = policy
+}
+
+func (r *StreamReader) Read(p []byte) (n int, err error) {
+	for r.zeros == 0 && len(r.pending) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if err = r.next(); err != nil {
+			return 0, err
+		}
+	}
+	if r.zeros > 0 {
+		n = len(p)
+		if uint64(n) > r.zeros {
+			n = int(r.zeros)
+		}
+		clear(p[:n])
+		r.zeros -= uint64(n)
+		return n, nil
+	}
+	n = copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Read the next frame of the stream into pending.
+func (r *StreamReader) next() error {
+	f, err := r.rx.Read()
+	if err != nil {
+		// Missed frames show up as a gap in the offsets.
+		if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+			return nil
+		}
+		return err
+	}
+	if f.Synthesized || len(f.Metadata) < streamHeaderLength {
+		return nil
+	}
+	offset := binary.BigEndian.Uint64(f.Metadata)
+	flags := f.Metadata[8]
+	data := f.Data
+
+	if !r.started {
+		r.started = true
+		r.offset = offset
+	}
+	if offset < r.offset {
+		// Already read, keep only what is new.
+		if r.offset-offset >= uint64(len(data)) {
+			data = nil
+		} else {
+			data = data[r.offset-offset:]
+		}
+		offset = r.offset
+	}
+	if offset > r.offset {
+		gap := offset - r.offset
+		switch r.policy {
+		case GapError:
+			err = fmt.Errorf("%w: %d bytes missing at offset %d", ErrStreamGap, gap, r.offset)
+		case GapZeroFill:
+			r.zeros = gap
+		}
+		r.offset = offset
+	}
+	r.pending = data
+	r.offset += uint64(len(data))
+	r.eof = flags&streamEOF != 0
+	return err
+}
@@ -0,0 +1,117 @@
+package streamcast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// pipeTx is a Tx feeding a pipeRxConn, dropping the listed frame ids.
+type pipeTx struct {
+	conn *pipeRxConn
+	id   uint32
+	drop map[uint32]bool
+}
+
+func (tx *pipeTx) Write(metadata []byte, data []byte) error {
+	return tx.WriteContext(context.Background(), metadata, data)
+}
+
+func (tx *pipeTx) WriteContext(ctx context.Context, metadata []byte, data []byte) error {
+	tx.id++
+	if !tx.drop[tx.id] {
+		tx.conn.pushFrame(&Frame{FrameId: tx.id, Metadata: metadata, Data: data})
+	}
+	return nil
+}
+
+func (tx *pipeTx) SetTimeout(t time.Duration) {}
+func (tx *pipeTx) Close()                     {}
+
+func streamPayload(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i%251 + 1)
+	}
+	return b
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, time.Millisecond, 10*time.Millisecond)
+	w := NewStreamWriter(&pipeTx{conn: conn})
+	payload := streamPayload(3*StreamChunkSize + 10)
+	if n, err := w.Write(payload); err != nil || n != len(payload) {
+		t.Fatalf("Wrote %d: %v", n, err)
+	}
+	w.Close()
+
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, NewStreamReader(rx)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), payload) {
+		t.Fatalf("Stream corrupted: %d bytes read", out.Len())
+	}
+}
+
+func TestStreamJoinMidway(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, time.Millisecond, 10*time.Millisecond)
+	w := NewStreamWriter(&pipeTx{conn: conn, drop: map[uint32]bool{1: true, 2: true}})
+	payload := streamPayload(3 * StreamChunkSize)
+	w.Write(payload)
+	w.Close()
+
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, NewStreamReader(rx)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), payload[2*StreamChunkSize:]) {
+		t.Fatalf("Read %d bytes, expected the last chunk", out.Len())
+	}
+}
+
+func TestStreamGapPolicies(t *testing.T) {
+	payload := streamPayload(3 * StreamChunkSize)
+	for _, policy := range []GapPolicy{GapError, GapZeroFill, GapSkip} {
+		rx, conn, clock := fakeIsoc(t, time.Millisecond, 10*time.Millisecond)
+		rx.SetResync(ResyncSkip, 0)
+		w := NewStreamWriter(&pipeTx{conn: conn, drop: map[uint32]bool{2: true}})
+		w.Write(payload)
+		w.Close()
+		go func() {
+			clock.BlockUntil(1)
+			clock.Advance(20 * time.Millisecond)
+		}()
+
+		r := NewStreamReader(rx)
+		r.SetGapPolicy(policy)
+		var out bytes.Buffer
+		_, err := io.Copy(&out, r)
+
+		first, rest := payload[:StreamChunkSize], payload[2*StreamChunkSize:]
+		var expected []byte
+		switch policy {
+		case GapError:
+			if !errors.Is(err, ErrStreamGap) {
+				t.Fatalf("Expected gap error, got %v", err)
+			}
+			expected = first
+			// Reading on continues after the gap.
+			io.Copy(&out, r)
+			expected = append(expected, rest...)
+		case GapZeroFill:
+			expected = append(append(append([]byte(nil), first...), make([]byte, StreamChunkSize)...), rest...)
+		case GapSkip:
+			expected = append(append([]byte(nil), first...), rest...)
+		}
+		if policy != GapError && err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), expected) {
+			t.Fatalf("Policy %d: read %d bytes, expected %d", policy, out.Len(), len(expected))
+		}
+	}
+}
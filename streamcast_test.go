@@ -2,6 +2,8 @@ package streamcast
 
 import (
 	"encoding/binary"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -27,3 +29,97 @@ func p(id uint32, delayMicroseconds uint32) (p Packet) {
 	p = Packet{id: id, delay: time.Duration(delayMicroseconds) * time.Microsecond}
 	return
 }
+
+// pipeRxConn is an in-memory RxConn whose deadlines follow a Clock.
+type pipeRxConn struct {
+	clock    Clock
+	packets  chan []byte
+	errs     chan error
+	changed  chan struct{}
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func newPipeRxConn(clock Clock) *pipeRxConn {
+	return &pipeRxConn{
+		clock:   clock,
+		packets: make(chan []byte, 1024),
+		errs:    make(chan error, 16),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+func (c *pipeRxConn) push(ids ...uint32) {
+	for _, id := range ids {
+		f := makeFrame(id)
+		c.pushFrame(&f)
+	}
+}
+
+func (c *pipeRxConn) pushFrame(f *Frame) {
+	var b [MAX_FRAME_LENGTH]byte
+	n, err := f.Write(b[:])
+	if err != nil {
+		panic(err)
+	}
+	c.packets <- append([]byte(nil), b[:n]...)
+}
+
+func (c *pipeRxConn) Close()       {}
+func (c *pipeRxConn) Reset() error { return nil }
+
+// Like a socket, changing the deadline affects a Read in progress.
+func (c *pipeRxConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *pipeRxConn) Read(b []byte) (int, error) {
+	for {
+		// Errors are injected between packets, ahead of those pushed later.
+		select {
+		case err := <-c.errs:
+			return 0, err
+		default:
+		}
+		c.mu.Lock()
+		deadline := c.deadline
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		var timer Timer
+		if !deadline.IsZero() {
+			d := deadline.Sub(c.clock.Now())
+			if d <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			// Only start a timer once drained, so FakeClock.BlockUntil(1)
+			// means the reader is idle.
+			select {
+			case p := <-c.packets:
+				return copy(b, p), nil
+			default:
+			}
+			timer = c.clock.NewTimer(d)
+			timeout = timer.C()
+		}
+		select {
+		case p := <-c.packets:
+			stopTimer(timer)
+			return copy(b, p), nil
+		case err := <-c.errs:
+			stopTimer(timer)
+			return 0, err
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-c.changed:
+			stopTimer(timer)
+		}
+	}
+}
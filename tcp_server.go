@@ -1,53 +1,161 @@
 package streamcast
 
 import (
+	"context"
+	"crypto/tls"
+	"log"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TcpServer fans frames out to its clients. Each client has its own
+// bounded queue, so a slow client loses frames rather than holding up the
+// others, and one whose connection stalls for longer than the write timeout
+// is dropped.
 type TcpServer struct {
-	clients  []*Client
-	joins    chan net.Conn
-	incoming chan []byte
-	outgoing chan []byte
+	listener     net.Listener
+	mu           sync.Mutex
+	clients      []*Client
+	joins        chan net.Conn
+	writeTimeout time.Duration
+	dropped      atomic.Uint64
+	closed       bool
+	// Closed by Close to stop Listen and turn away pending joins.
+	quit chan struct{}
 }
 
 func (tcpServer *TcpServer) Broadcast(data []byte) {
+	tcpServer.BroadcastContext(context.Background(), data)
+}
+
+// BroadcastContext queues data for every client without blocking. Data for
+// a client whose queue is full is dropped. Returns ctx.Err() if the context
+// is already done. Disconnected clients are removed.
+func (tcpServer *TcpServer) BroadcastContext(ctx context.Context, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, client := range tcpServer.connected() {
+		if !client.send(data) {
+			tcpServer.dropped.Add(1)
+			if debug {
+				log.Printf("Queue full for %s, dropping frame", client.conn.RemoteAddr())
+			}
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of frames dropped because a client's queue was
+// full.
+func (tcpServer *TcpServer) Dropped() uint64 {
+	return tcpServer.dropped.Load()
+}
+
+// SetWriteTimeout sets how long a write to one client may stall before that
+// client is disconnected. It applies to clients that join afterwards.
+func (tcpServer *TcpServer) SetWriteTimeout(t time.Duration) {
+	tcpServer.mu.Lock()
+	defer tcpServer.mu.Unlock()
+	tcpServer.writeTimeout = t
+}
+
+// Prune disconnected clients and return the rest.
+func (tcpServer *TcpServer) connected() []*Client {
+	tcpServer.mu.Lock()
+	defer tcpServer.mu.Unlock()
+	clients := tcpServer.clients[:0]
 	for _, client := range tcpServer.clients {
-		client.outgoing <- data
+		select {
+		case <-client.done:
+		default:
+			clients = append(clients, client)
+		}
 	}
+	tcpServer.clients = clients
+	return append([]*Client(nil), clients...)
 }
 
+// Join adds a client for connection, or closes it if the server is closed.
 func (tcpServer *TcpServer) Join(connection net.Conn) {
-	client := NewClient(connection)
+	tcpServer.mu.Lock()
+	defer tcpServer.mu.Unlock()
+	if tcpServer.closed {
+		connection.Close()
+		return
+	}
+	client := newClient(connection, tcpServer.writeTimeout)
 	tcpServer.clients = append(tcpServer.clients, client)
-	go func() {
-		for {
-			tcpServer.incoming <- <-client.incoming
-		}
-	}()
 }
 
 func (tcpServer *TcpServer) Listen() {
 	go func() {
 		for {
 			select {
-			case data := <-tcpServer.incoming:
-				tcpServer.Broadcast(data)
 			case conn := <-tcpServer.joins:
 				tcpServer.Join(conn)
+			case <-tcpServer.quit:
+				return
 			}
 		}
 	}()
 }
 
+// Hand conn to Listen, or close it once the server is closed.
+func (tcpServer *TcpServer) enqueue(conn net.Conn) {
+	select {
+	case tcpServer.joins <- conn:
+	case <-tcpServer.quit:
+		conn.Close()
+	}
+}
+
 func (tcpServer *TcpServer) Accept(listener net.Listener) {
 	for {
-		conn, _ := listener.Accept()
-		tcpServer.joins <- conn
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			go tcpServer.handshake(tlsConn)
+			continue
+		}
+		tcpServer.enqueue(conn)
+	}
+}
+
+// Clients join once the TLS handshake, including any client certificate
+// verification, has succeeded.
+func (tcpServer *TcpServer) handshake(conn *tls.Conn) {
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		if debug {
+			log.Printf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+		}
+		conn.Close()
+		return
 	}
+	conn.SetDeadline(time.Time{})
+	tcpServer.enqueue(conn)
 }
 
+// Close disconnects the clients and stops accepting new ones. Clients still
+// completing a TLS handshake are disconnected once it finishes.
 func (tcpServer *TcpServer) Close() {
+	tcpServer.mu.Lock()
+	defer tcpServer.mu.Unlock()
+	if tcpServer.closed {
+		return
+	}
+	tcpServer.closed = true
+	close(tcpServer.quit)
+	if tcpServer.listener != nil {
+		tcpServer.listener.Close()
+	}
 	for _, client := range tcpServer.clients {
 		client.Close()
 	}
@@ -55,10 +163,10 @@ func (tcpServer *TcpServer) Close() {
 
 func NewTcpServer() *TcpServer {
 	tcpServer := &TcpServer{
-		clients:  make([]*Client, 0),
-		joins:    make(chan net.Conn),
-		incoming: make(chan []byte),
-		outgoing: make(chan []byte),
+		clients:      make([]*Client, 0),
+		joins:        make(chan net.Conn),
+		writeTimeout: time.Second,
+		quit:         make(chan struct{}),
 	}
 
 	tcpServer.Listen()
@@ -66,11 +174,20 @@ func NewTcpServer() *TcpServer {
 }
 
 func StartTcpServer(addr string) (error, *TcpServer) {
+	return startTcpServer("tcp", addr, nil)
+}
+
+// With a non-nil config clients are served over TLS.
+func startTcpServer(network string, addr string, config *tls.Config) (error, *TcpServer) {
 	tcpServer := NewTcpServer()
-	listener, err := net.Listen("tcp", addr)
+	listener, err := net.Listen(network, addr)
 	if err != nil {
 		return err, nil
 	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	tcpServer.listener = listener
 	go tcpServer.Accept(listener)
 	return err, tcpServer
 }
@@ -1,54 +1,77 @@
 package streamcast
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 )
 
 type TcpTx struct {
 	addr      string
 	tcpServer *TcpServer
-	currentId uint32
-	timeout   time.Duration
+	frameStamper
 }
 
 func NewTcpTx(network string, port int) (s *TcpTx, err error) {
-	addr := fmt.Sprintf("%s:%d", network, port)
+	return newTcpTx("tcp", network, port, nil)
+}
+
+// NewTlsTcpTx serves frames over TLS. config must hold the server
+// certificate; set ClientAuth and ClientCAs in it to require client
+// certificates.
+func NewTlsTcpTx(network string, port int, config *tls.Config) (s *TcpTx, err error) {
+	if config == nil {
+		return nil, fmt.Errorf("Missing TLS config")
+	}
+	return newTcpTx("tcp", network, port, config)
+}
+
+// protocol is "tcp", or "tcp4" or "tcp6" to restrict the address family.
+func newTcpTx(protocol string, network string, port int, config *tls.Config) (s *TcpTx, err error) {
+	addr := net.JoinHostPort(network, strconv.Itoa(port))
 	s = new(TcpTx)
 	s.addr = addr
-	err, s.tcpServer = StartTcpServer(addr)
+	err, s.tcpServer = startTcpServer(protocol, addr, config)
 	if err != nil {
 		return nil, err
 	}
-	s.currentId = 1
-	s.timeout = 1 * time.Second
+	s.frameStamper = newFrameStamper()
 
 	return
 }
 
 func (s *TcpTx) WriteFrame(f *Frame) (err error) {
+	return s.WriteFrameContext(context.Background(), f)
+}
+
+// WriteFrameContext queues the frame for every connected client without
+// blocking, see TcpServer.
+func (s *TcpTx) WriteFrameContext(ctx context.Context, f *Frame) (err error) {
 	var b [MAX_FRAME_LENGTH]byte
 
 	n, err := f.Write(b[:])
 	if err != nil {
 		return err
 	}
-	s.tcpServer.Broadcast(b[:n])
-	return
+	return s.tcpServer.BroadcastContext(ctx, appendStreamFrame(nil, b[:n]))
 }
 
 func (s *TcpTx) Write(metadata []byte, data []byte) (err error) {
-	var f Frame
-	f.Data = data
-	f.Metadata = metadata
-	f.FrameId = s.currentId
-	s.currentId += 1
-	s.WriteFrame(&f)
-	return
+	return s.WriteContext(context.Background(), metadata, data)
+}
+
+func (s *TcpTx) WriteContext(ctx context.Context, metadata []byte, data []byte) (err error) {
+	f := s.next(metadata, data)
+	return s.WriteFrameContext(ctx, &f)
 }
 
+// SetTimeout sets how long a write to one client may stall before that
+// client is disconnected. It applies to clients that connect afterwards.
 func (s *TcpTx) SetTimeout(t time.Duration) {
-	s.timeout = t
+	s.tcpServer.SetWriteTimeout(t)
 }
 
 func (s *TcpTx) Close() {
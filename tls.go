@@ -0,0 +1,55 @@
+package streamcast
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// SetTLSConfig makes the connection use TLS. Without a ServerName in config
+// the server's certificate is verified for the host it was created with.
+// Set Certificates to present a client certificate, and VerifyConnection,
+// for instance to VerifyPinnedKeys, to pin the server key. Takes effect on
+// Reset.
+func (tcpRxConn *TcpRxConn) SetTLSConfig(config *tls.Config) {
+	if config != nil && config.ServerName == "" && !config.InsecureSkipVerify {
+		config = config.Clone()
+		config.ServerName = tcpRxConn.host
+	}
+	tcpRxConn.mu.Lock()
+	defer tcpRxConn.mu.Unlock()
+	tcpRxConn.tls = config
+}
+
+func (tcpRxConn *TcpRxConn) tlsConfig() *tls.Config {
+	tcpRxConn.mu.Lock()
+	defer tcpRxConn.mu.Unlock()
+	return tcpRxConn.tls
+}
+
+// SPKIFingerprint is the SHA-256 hash of the certificate's public key, as
+// used for pinning.
+func SPKIFingerprint(cert *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
+
+// VerifyPinnedKeys returns a tls.Config VerifyConnection function accepting
+// only peers whose certificate has one of the given SPKI fingerprints. It
+// runs in addition to normal verification; with InsecureSkipVerify it
+// allows self-signed servers to be trusted by key alone.
+func VerifyPinnedKeys(pins ...[sha256.Size]byte) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("No peer certificate to check against pins")
+		}
+		fingerprint := SPKIFingerprint(state.PeerCertificates[0])
+		for _, pin := range pins {
+			if subtle.ConstantTimeCompare(fingerprint[:], pin[:]) == 1 {
+				return nil
+			}
+		}
+		return fmt.Errorf("Peer key %x is not pinned", fingerprint)
+	}
+}
@@ -0,0 +1,181 @@
+package streamcast
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// Issue a certificate signed by parent, or self-signed if parent is nil.
+func issueCert(t *testing.T, name string, parent *tls.Certificate, isCA bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func tlsRx(t *testing.T, port int, config *tls.Config) (*RxIsochronous, error) {
+	t.Helper()
+	conn, err := NewTcpRxConn("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetTLSConfig(config)
+	return InitRxIsochronous(conn, time.Millisecond, 100*time.Millisecond)
+}
+
+// Send until the receiver gets a frame or fails.
+func tlsExchange(t *testing.T, tx *TcpTx, rx *RxIsochronous) error {
+	t.Helper()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				f := makeFrame(1)
+				tx.Write(f.Metadata, f.Data)
+			}
+		}
+	}()
+	for {
+		_, err := rx.Read()
+		if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+			continue
+		}
+		return err
+	}
+}
+
+func TestTLSMutualAuth(t *testing.T) {
+	ca := issueCert(t, "ca", nil, true)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	server := issueCert(t, "server", &ca, false)
+	client := issueCert(t, "client", &ca, false)
+
+	tx, err := NewTlsTcpTx("127.0.0.1", 8904, &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	rx, err := tlsRx(t, 8904, &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{client}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tlsExchange(t, tx, rx); err != nil {
+		t.Fatal(err)
+	}
+	rx.Close()
+
+	// Without a client certificate the server hangs up.
+	rx, err = tlsRx(t, 8904, &tls.Config{RootCAs: pool})
+	if err == nil {
+		err = tlsExchange(t, tx, rx)
+		rx.Close()
+	}
+	if err == nil {
+		t.Fatalf("Expected client without certificate to be rejected")
+	}
+
+	// Nor is a server from another CA trusted.
+	if _, err = tlsRx(t, 8904, &tls.Config{Certificates: []tls.Certificate{client}}); err == nil {
+		t.Fatalf("Expected unknown server CA to be rejected")
+	}
+}
+
+func TestTLSPinning(t *testing.T) {
+	server := issueCert(t, "server", nil, false)
+	other := issueCert(t, "other", nil, false)
+	tx, err := NewTlsTcpTx("127.0.0.1", 8905, &tls.Config{Certificates: []tls.Certificate{server}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	// Self-signed, so trusted by key alone.
+	rx, err := tlsRx(t, 8905, &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection:   VerifyPinnedKeys(SPKIFingerprint(other.Leaf), SPKIFingerprint(server.Leaf)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tlsExchange(t, tx, rx); err != nil {
+		t.Fatal(err)
+	}
+	rx.Close()
+
+	_, err = tlsRx(t, 8905, &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection:   VerifyPinnedKeys(SPKIFingerprint(other.Leaf)),
+	})
+	if err == nil {
+		t.Fatalf("Expected unpinned server to be rejected")
+	}
+}
+
+// A handshake still in progress when the server closes must not leave a
+// client behind.
+func TestTLSHandshakeAfterClose(t *testing.T) {
+	cert := issueCert(t, "server", nil, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	server := NewTcpServer()
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	go server.handshake(tls.Server(serverSide, &tls.Config{Certificates: []tls.Certificate{cert}}))
+	server.Close()
+
+	conn := tls.Client(clientSide, &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := conn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := conn.Read(make([]byte, 1))
+	if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+		t.Fatalf("Connection left open after Close")
+	}
+	if n := len(server.connected()); n != 0 {
+		t.Fatalf("%d clients joined a closed server", n)
+	}
+}
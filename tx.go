@@ -1,6 +1,7 @@
 package streamcast
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -8,16 +9,25 @@ import (
 
 type Tx interface {
 	Write(metadata []byte, data []byte) (err error)
+	// WriteContext is Write bound to ctx, returning ctx.Err() if the
+	// context ends before the frame is written.
+	WriteContext(ctx context.Context, metadata []byte, data []byte) (err error)
 	SetTimeout(t time.Duration)
 	Close()
 }
 
+// For the "unix" and "unixgram" protocols network is the socket path and
+// port is ignored.
 func NewTx(protocol string, network string, port int) (t Tx, err error) {
 	switch protocol {
-	case "tcp":
-		t, err = NewTcpTx(network, port)
-	case "udp":
-		t, err = NewUdpTx(network, port, 1)
+	case "tcp", "tcp4", "tcp6":
+		t, err = newTcpTx(protocol, network, port, nil)
+	case "udp", "udp4", "udp6":
+		t, err = newUdpTx(protocol, network, port, 1)
+	case "unix":
+		t, err = NewUnixTx(network)
+	case "unixgram":
+		t, err = NewUnixgramTx(network)
 	default:
 		err = errors.New(fmt.Sprintf("Unsupported Protocol: %s.", protocol))
 	}
@@ -0,0 +1,152 @@
+package streamcast
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Codec converts values to and from frame data.
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(b []byte) (T, error)
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Unmarshal(b []byte) (v T, err error) {
+	err = json.Unmarshal(b, &v)
+	return v, err
+}
+
+// GobCodec encodes values with encoding/gob. Frames may be lost, so every
+// frame is a self-contained gob stream carrying its own type information.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Unmarshal(b []byte) (v T, err error) {
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// BinaryCodec uses the type's encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler (on T or *T) if it has them, and otherwise
+// encoding/binary in big endian, which requires a fixed-size T. A pointer
+// T is decoded into a newly allocated value.
+type BinaryCodec[T any] struct{}
+
+func (BinaryCodec[T]) Marshal(v T) ([]byte, error) {
+	if m, ok := any(v).(encoding.BinaryMarshaler); ok {
+		return m.MarshalBinary()
+	}
+	if m, ok := any(&v).(encoding.BinaryMarshaler); ok {
+		return m.MarshalBinary()
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (BinaryCodec[T]) Unmarshal(b []byte) (v T, err error) {
+	// Decode into the pointee of a pointer T, otherwise into v itself.
+	var target any = &v
+	if t := reflect.TypeFor[T](); t.Kind() == reflect.Pointer {
+		v = reflect.New(t.Elem()).Interface().(T)
+		target = v
+	}
+	if u, ok := target.(encoding.BinaryUnmarshaler); ok {
+		err = u.UnmarshalBinary(b)
+		return v, err
+	}
+	err = binary.Read(bytes.NewReader(b), binary.BigEndian, target)
+	return v, err
+}
+
+// TypedTx sends values of type T as frame data on a Tx.
+type TypedTx[T any] struct {
+	tx    Tx
+	codec Codec[T]
+}
+
+func NewTypedTx[T any](tx Tx, codec Codec[T]) (s *TypedTx[T]) {
+	s = new(TypedTx[T])
+	s.tx = tx
+	s.codec = codec
+	return s
+}
+
+func (s *TypedTx[T]) Write(v T) error {
+	return s.WriteContext(context.Background(), v)
+}
+
+func (s *TypedTx[T]) WriteContext(ctx context.Context, v T) error {
+	data, err := s.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.tx.WriteContext(ctx, nil, data)
+}
+
+func (s *TypedTx[T]) Close() {
+	s.tx.Close()
+}
+
+// TypedRx reads values of type T from the frames of a receiver.
+// Concealment frames are decoded like any other, so with ConcealSilence
+// expect decoding errors for lost frames.
+type TypedRx[T any] struct {
+	rx    *RxIsochronous
+	codec Codec[T]
+}
+
+func NewTypedRx[T any](rx *RxIsochronous, codec Codec[T]) (r *TypedRx[T]) {
+	r = new(TypedRx[T])
+	r.rx = rx
+	r.codec = codec
+	return r
+}
+
+func (r *TypedRx[T]) Read() (v T, err error) {
+	return r.ReadContext(context.Background())
+}
+
+func (r *TypedRx[T]) ReadContext(ctx context.Context) (v T, err error) {
+	v, _, err = r.ReadFrameContext(ctx)
+	return v, err
+}
+
+// ReadFrameContext is ReadContext also returning the frame, for its id,
+// flags and source.
+func (r *TypedRx[T]) ReadFrameContext(ctx context.Context) (v T, f *Frame, err error) {
+	f, err = r.rx.ReadContext(ctx)
+	if err != nil {
+		return v, nil, err
+	}
+	if v, err = r.codec.Unmarshal(f.Data); err != nil {
+		return v, f, fmt.Errorf("Decoding frame %d: %w", f.FrameId, err)
+	}
+	return v, f, nil
+}
+
+func (r *TypedRx[T]) Close() {
+	r.rx.Close()
+}
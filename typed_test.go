@@ -0,0 +1,74 @@
+package streamcast
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type reading struct {
+	Sensor string
+	Value  float64
+}
+
+type sample struct {
+	Channel uint16
+	Level   int32
+}
+
+// label marshals through pointer receivers, and its string field rules
+// out encoding/binary.
+type label struct {
+	Name string
+}
+
+func (l *label) MarshalBinary() ([]byte, error) {
+	return []byte(l.Name), nil
+}
+
+func (l *label) UnmarshalBinary(b []byte) error {
+	l.Name = string(b)
+	return nil
+}
+
+func typedRoundTrip[T any](t *testing.T, codec Codec[T], values ...T) {
+	t.Helper()
+	rx, conn, _ := fakeIsoc(t, time.Millisecond, 10*time.Millisecond)
+	tx := NewTypedTx[T](&pipeTx{conn: conn}, codec)
+	trx := NewTypedRx[T](rx, codec)
+	for _, v := range values {
+		if err := tx.Write(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range values {
+		v, err := trx.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Fatalf("Read %v, expected %v", v, expected)
+		}
+	}
+}
+
+func TestTypedCodecs(t *testing.T) {
+	values := []reading{{"temp", 21.5}, {"humidity", 40}}
+	typedRoundTrip[reading](t, JSONCodec[reading]{}, values...)
+	typedRoundTrip[reading](t, GobCodec[reading]{}, values...)
+	typedRoundTrip[sample](t, BinaryCodec[sample]{}, sample{1, -5}, sample{2, 7})
+	// time.Time implements encoding.BinaryMarshaler.
+	typedRoundTrip[time.Time](t, BinaryCodec[time.Time]{}, time.Unix(10, 0).UTC(), time.Unix(20, 0).UTC())
+	typedRoundTrip[label](t, BinaryCodec[label]{}, label{"left"}, label{"right"})
+	typedRoundTrip[*label](t, BinaryCodec[*label]{}, &label{"left"}, &label{"right"})
+	typedRoundTrip[*sample](t, BinaryCodec[*sample]{}, &sample{1, -5}, &sample{2, 7})
+}
+
+func TestTypedDecodeError(t *testing.T) {
+	rx, conn, _ := fakeIsoc(t, time.Millisecond, 10*time.Millisecond)
+	conn.push(1)
+	_, err := NewTypedRx[reading](rx, JSONCodec[reading]{}).Read()
+	if err == nil {
+		t.Fatalf("Expected decoding error")
+	}
+}
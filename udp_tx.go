@@ -1,65 +1,97 @@
 package streamcast
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
 type UdpTx struct {
 	conn         net.PacketConn
-	addr         net.Addr
+	addrs        []net.Addr
 	copiesToSend int
-	currentId    uint32
 	timeout      time.Duration
+	frameStamper
 }
 
 func NewUdpTx(network string, port int, copiesToSend int) (s *UdpTx, err error) {
-	addr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("%s:%d", network, port))
+	return newUdpTx("udp", network, port, copiesToSend)
+}
+
+// protocol is "udp", or "udp4" or "udp6" to restrict the address family.
+func newUdpTx(protocol string, network string, port int, copiesToSend int) (s *UdpTx, err error) {
+	addr, err := net.ResolveUDPAddr(protocol, net.JoinHostPort(network, strconv.Itoa(port)))
 	if err != nil {
 		return nil, err
 	}
 	s = new(UdpTx)
-	s.addr = addr
-	s.conn, err = net.ListenPacket("udp4", "0.0.0.0:0")
+	s.addrs = []net.Addr{addr}
+	// Send from a socket of the destination's family, so IPv4 socket
+	// options apply to IPv4 destinations.
+	s.conn, err = net.ListenPacket(udpNetwork(addr.IP), ":0")
 	if err != nil {
 		return nil, err
 	}
-	s.currentId = 1
+	s.frameStamper = newFrameStamper()
 	s.copiesToSend = copiesToSend
 	s.timeout = 1 * time.Second
 
 	return
 }
 
+// The UDP network matching the family of ip.
+func udpNetwork(ip net.IP) string {
+	if ip.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
+
 func (s *UdpTx) WriteFrame(f *Frame) (err error) {
+	return s.WriteFrameContext(context.Background(), f)
+}
+
+func (s *UdpTx) WriteFrameContext(ctx context.Context, f *Frame) (err error) {
 	var b [MAX_FRAME_LENGTH]byte
-	s.conn.SetDeadline(time.Now().Add(s.timeout))
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	deadline := watchContext(ctx, s.conn.SetDeadline)
+	defer func() {
+		if ctxErr := deadline.Close(); ctxErr != nil && err != nil {
+			err = ctxErr
+		}
+	}()
+	// Sockets only know real time, whatever clock stamps the frames.
+	deadline.SetDeadline(time.Now().Add(s.timeout))
 
 	n, err := f.Write(b[:])
 	if err != nil {
 		return err
 	}
 	for i := 0; i < s.copiesToSend; i++ {
-		written, err := s.conn.WriteTo(b[:n], s.addr)
-		if err != nil {
-			return err
-		}
-		if n != written {
-			return fmt.Errorf("Could not write full chunk %d/%d", written, n)
+		for _, addr := range s.addrs {
+			written, err := s.conn.WriteTo(b[:n], addr)
+			if err != nil {
+				return err
+			}
+			if n != written {
+				return fmt.Errorf("Could not write full chunk %d/%d", written, n)
+			}
 		}
 	}
 	return
 }
 
 func (s *UdpTx) Write(metadata []byte, data []byte) (err error) {
-	var f Frame
-	f.Data = data
-	f.Metadata = metadata
-	f.FrameId = s.currentId
-	s.currentId += 1
-	s.WriteFrame(&f)
-	return
+	return s.WriteContext(context.Background(), metadata, data)
+}
+
+func (s *UdpTx) WriteContext(ctx context.Context, metadata []byte, data []byte) (err error) {
+	f := s.next(metadata, data)
+	return s.WriteFrameContext(ctx, &f)
 }
 
 func (s *UdpTx) SetTimeout(t time.Duration) {
@@ -0,0 +1,186 @@
+package streamcast
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Unix domain socket transports. The side that creates the socket file
+// (UnixgramRxConn, UnixTx) removes a stale file left by a process that died
+// without cleaning up, and removes its file on Close.
+
+// Remove the socket file at path unless it is in use. Fails if path exists
+// but is not a socket.
+func removeStaleSocket(network string, path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("Not a socket: %s", path)
+	}
+	if conn, err := net.Dial(network, path); err == nil {
+		conn.Close()
+		return fmt.Errorf("Socket in use: %s", path)
+	}
+	return os.Remove(path)
+}
+
+/* Unix datagram Receiver Connection. Owns the socket file senders write to. */
+type UnixgramRxConn struct {
+	mu   sync.Mutex
+	conn *net.UnixConn
+	addr *net.UnixAddr
+	mode os.FileMode
+}
+
+func NewUnixgramRxConn(path string) (c *UnixgramRxConn) {
+	c = new(UnixgramRxConn)
+	c.addr = &net.UnixAddr{Name: path, Net: "unixgram"}
+	return c
+}
+
+// SetMode sets the permissions of the socket file, which control who may
+// send. Zero leaves them to the umask. Takes effect on Reset. The mode is
+// applied just after the file is created, so where access matters also
+// restrict the directory holding it.
+func (c *UnixgramRxConn) SetMode(mode os.FileMode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mode = mode
+}
+
+func (c *UnixgramRxConn) Reset() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.close()
+	if err = removeStaleSocket("unixgram", c.addr.Name); err != nil {
+		return err
+	}
+	c.conn, err = net.ListenUnixgram("unixgram", c.addr)
+	if err != nil {
+		return err
+	}
+	if c.mode != 0 {
+		if err = os.Chmod(c.addr.Name, c.mode); err != nil {
+			c.close()
+			return err
+		}
+	}
+	return
+}
+
+func (c *UnixgramRxConn) SetDeadline(t time.Time) error {
+	conn := c.current()
+	if conn == nil {
+		return net.ErrClosed
+	}
+	return conn.SetDeadline(t)
+}
+
+func (c *UnixgramRxConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.close()
+}
+
+func (c *UnixgramRxConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+		os.Remove(c.addr.Name)
+	}
+}
+
+func (c *UnixgramRxConn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadFrom(b)
+	return n, err
+}
+
+func (c *UnixgramRxConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	conn := c.current()
+	if conn == nil {
+		return 0, nil, net.ErrClosed
+	}
+	n, addr, err := conn.ReadFromUnix(b)
+	// Don't return a nil *UnixAddr as a non-nil net.Addr.
+	if addr == nil {
+		return n, nil, err
+	}
+	return n, addr, err
+}
+
+func (c *UnixgramRxConn) current() *net.UnixConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+/* Unix stream Receiver Connection: a client of a UnixTx. */
+type UnixRxConn struct {
+	mu     sync.Mutex
+	conn   *net.UnixConn
+	framer *streamFramer
+	addr   *net.UnixAddr
+}
+
+func NewUnixRxConn(path string) (c *UnixRxConn) {
+	c = new(UnixRxConn)
+	c.addr = &net.UnixAddr{Name: path, Net: "unix"}
+	return c
+}
+
+func (c *UnixRxConn) Reset() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.close()
+	c.conn, err = net.DialUnix("unix", nil, c.addr)
+	if err != nil {
+		return err
+	}
+	c.framer = newStreamFramer(c.conn)
+	return
+}
+
+func (c *UnixRxConn) SetDeadline(t time.Time) error {
+	conn := c.current()
+	if conn == nil {
+		return net.ErrClosed
+	}
+	return conn.SetDeadline(t)
+}
+
+func (c *UnixRxConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.close()
+}
+
+func (c *UnixRxConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// Read reads one frame from the stream.
+func (c *UnixRxConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	conn, framer := c.conn, c.framer
+	c.mu.Unlock()
+	if conn == nil {
+		return 0, net.ErrClosed
+	}
+	return framer.Read(b)
+}
+
+func (c *UnixRxConn) current() *net.UnixConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
@@ -0,0 +1,72 @@
+package streamcast
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixTransports(t *testing.T) {
+	for _, protocol := range []string{"unixgram", "unix"} {
+		path := filepath.Join(t.TempDir(), "stream.sock")
+		tx, err := NewTx(protocol, path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rx, err := NewRxIsochronous(protocol, path, 0, time.Millisecond, 100*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitForSubscribers(t, tx, 1)
+		f := makeFrame(1)
+		if err = tx.Write(f.Metadata, f.Data); err != nil {
+			t.Fatal(err)
+		}
+		expectFrame(t, rx, 1)
+
+		rx.Close()
+		tx.Close()
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s: socket file not removed", protocol)
+		}
+	}
+}
+
+func TestUnixSocketFileLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rx.sock")
+
+	// A socket file left behind by a dead process is replaced.
+	stale, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.Close()
+	conn := NewUnixgramRxConn(path)
+	conn.SetMode(0600)
+	if err = conn.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Socket mode %v", info.Mode().Perm())
+	}
+
+	// A live socket or a regular file is left alone.
+	if err = NewUnixgramRxConn(path).Reset(); err == nil {
+		t.Fatalf("Expected error for socket in use")
+	}
+	file := filepath.Join(dir, "file")
+	if err = os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewUnixTx(file); err == nil {
+		t.Fatalf("Expected error for regular file")
+	}
+}
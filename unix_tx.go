@@ -0,0 +1,168 @@
+package streamcast
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// UnixgramTx sends frames to the socket file of a UnixgramRxConn.
+type UnixgramTx struct {
+	conn    net.PacketConn
+	dir     string
+	addr    net.Addr
+	timeout time.Duration
+	frameStamper
+}
+
+func NewUnixgramTx(path string) (s *UnixgramTx, err error) {
+	s = new(UnixgramTx)
+	s.addr = &net.UnixAddr{Name: path, Net: "unixgram"}
+	s.conn, s.dir, err = listenUnixgramSender()
+	if err != nil {
+		return nil, err
+	}
+	s.frameStamper = newFrameStamper()
+	s.timeout = 1 * time.Second
+
+	return
+}
+
+// On Linux an empty address autobinds to a unique abstract name, so no
+// socket file is left behind. Elsewhere the socket is bound in a private
+// temporary directory, to be removed on Close.
+func listenUnixgramSender() (conn net.PacketConn, dir string, err error) {
+	if runtime.GOOS == "linux" {
+		conn, err = net.ListenPacket("unixgram", "")
+		return conn, "", err
+	}
+	if dir, err = os.MkdirTemp("", "streamcast"); err != nil {
+		return nil, "", err
+	}
+	if conn, err = net.ListenPacket("unixgram", filepath.Join(dir, "tx.sock")); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	return conn, dir, nil
+}
+
+func (s *UnixgramTx) WriteFrame(f *Frame) (err error) {
+	return s.WriteFrameContext(context.Background(), f)
+}
+
+func (s *UnixgramTx) WriteFrameContext(ctx context.Context, f *Frame) (err error) {
+	var b [MAX_FRAME_LENGTH]byte
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	deadline := watchContext(ctx, s.conn.SetDeadline)
+	defer func() {
+		if ctxErr := deadline.Close(); ctxErr != nil && err != nil {
+			err = ctxErr
+		}
+	}()
+	deadline.SetDeadline(time.Now().Add(s.timeout))
+
+	n, err := f.Write(b[:])
+	if err != nil {
+		return err
+	}
+	written, err := s.conn.WriteTo(b[:n], s.addr)
+	if err != nil {
+		return err
+	}
+	if n != written {
+		return fmt.Errorf("Could not write full chunk %d/%d", written, n)
+	}
+	return
+}
+
+func (s *UnixgramTx) Write(metadata []byte, data []byte) (err error) {
+	return s.WriteContext(context.Background(), metadata, data)
+}
+
+func (s *UnixgramTx) WriteContext(ctx context.Context, metadata []byte, data []byte) (err error) {
+	f := s.next(metadata, data)
+	return s.WriteFrameContext(ctx, &f)
+}
+
+func (s *UnixgramTx) SetTimeout(t time.Duration) {
+	s.timeout = t
+}
+
+func (s *UnixgramTx) Close() {
+	s.conn.Close()
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// UnixTx serves frames to UnixRxConn clients over a Unix stream socket,
+// like TcpTx. The socket file is removed on Close.
+type UnixTx struct {
+	path      string
+	tcpServer *TcpServer
+	frameStamper
+}
+
+func NewUnixTx(path string) (s *UnixTx, err error) {
+	if err = removeStaleSocket("unix", path); err != nil {
+		return nil, err
+	}
+	s = new(UnixTx)
+	s.path = path
+	err, s.tcpServer = startTcpServer("unix", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.frameStamper = newFrameStamper()
+
+	return
+}
+
+// SetMode sets the permissions of the socket file, which control who may
+// connect. Until then the file has the permissions left by the umask, so
+// where access matters also restrict the directory holding it.
+func (s *UnixTx) SetMode(mode os.FileMode) error {
+	return os.Chmod(s.path, mode)
+}
+
+func (s *UnixTx) WriteFrame(f *Frame) (err error) {
+	return s.WriteFrameContext(context.Background(), f)
+}
+
+// WriteFrameContext queues the frame for every connected client without
+// blocking, see TcpServer.
+func (s *UnixTx) WriteFrameContext(ctx context.Context, f *Frame) (err error) {
+	var b [MAX_FRAME_LENGTH]byte
+
+	n, err := f.Write(b[:])
+	if err != nil {
+		return err
+	}
+	return s.tcpServer.BroadcastContext(ctx, appendStreamFrame(nil, b[:n]))
+}
+
+func (s *UnixTx) Write(metadata []byte, data []byte) (err error) {
+	return s.WriteContext(context.Background(), metadata, data)
+}
+
+func (s *UnixTx) WriteContext(ctx context.Context, metadata []byte, data []byte) (err error) {
+	f := s.next(metadata, data)
+	return s.WriteFrameContext(ctx, &f)
+}
+
+// SetTimeout sets how long a write to one client may stall before that
+// client is disconnected. It applies to clients that connect afterwards.
+func (s *UnixTx) SetTimeout(t time.Duration) {
+	s.tcpServer.SetWriteTimeout(t)
+}
+
+// Close disconnects the clients and removes the socket file.
+func (s *UnixTx) Close() {
+	s.tcpServer.Close()
+}
@@ -0,0 +1,34 @@
+package streamcast
+
+import (
+	"time"
+)
+
+// SetVariableFrameRate derives frame release times and deadlines from the
+// sender timestamps carried in each frame (see UdpTx.SetTimestamps) instead
+// of the frame index. The frame period passed at construction becomes the
+// longest expected interval between frames: it bounds how long Read waits
+// for a frame whose timestamp is not yet known. The cache window is sized by
+// time. Must be called before the first Read.
+func (r *RxIsochronous) SetVariableFrameRate(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.vfr = enabled
+	r.resizeCache()
+}
+
+func (r *RxIsochronous) vfrReleaseAt(frameId uint32, f *Frame) time.Time {
+	if f != nil && !f.Timestamp.IsZero() && !r.baseStamp.IsZero() {
+		return r.baseTime.Add(f.Timestamp.Sub(r.baseStamp))
+	}
+
+	// Timestamp unknown: due no later than one period after the last
+	// release, or the next frame we do have, whichever comes first.
+	release := r.lastRelease.Add(r.framePeriod)
+	if later := r.cache.Oldest(); later != nil && int32(later.FrameId-frameId) > 0 && !later.Timestamp.IsZero() && !r.baseStamp.IsZero() {
+		if laterRelease := r.baseTime.Add(later.Timestamp.Sub(r.baseStamp)); laterRelease.Before(release) {
+			release = laterRelease
+		}
+	}
+	return release
+}
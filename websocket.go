@@ -0,0 +1,472 @@
+package streamcast
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Each frame is sent to browsers as one binary WebSocket message laid out
+// for a JavaScript DataView, all fields big endian:
+//
+//	offset  0  u32  frame id
+//	offset  4  u32  session id, 0 if none
+//	offset  8  f64  timestamp in ms since the Unix epoch, 0 if none
+//	offset 16  f64  nominal frame period in ms, 0 if none
+//	offset 24  u32  metadata length m
+//	offset 28       metadata (m bytes), then data to the end of the message
+//
+// In the browser:
+//
+//	const v = new DataView(msg.data), m = v.getUint32(24)
+//	const stamp = new Date(v.getFloat64(8))
+//	const metadata = new Uint8Array(msg.data, 28, m)
+//	const data = new Uint8Array(msg.data, 28 + m)
+//
+// with the socket's binaryType set to "arraybuffer".
+const (
+	webSocketHeaderLength = 28
+	defaultWebSocketQueue = 64
+
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpBinary = 0x2
+	wsOpClose  = 0x8
+	wsOpPing   = 0x9
+	wsOpPong   = 0xa
+
+	wsCloseNormal     = 1000
+	wsCloseGoingAway  = 1001
+	wsCloseProtocol   = 1002
+	wsCloseTooBig     = 1009
+	wsMaxClientFrame  = 64 * 1024
+	wsMaxControlFrame = 125
+)
+
+// WebSocketTx is a Tx serving its frames to WebSocket clients. It is an
+// http.Handler: mount it on a path and every client upgraded there receives
+// the frames written from then on, in the layout described above.
+//
+// Each client has its own bounded queue. Messages for a client whose queue
+// is full are dropped, and a client whose socket stalls for longer than the
+// timeout is disconnected, so a slow browser never holds up the others.
+//
+// Browsers let any page open a WebSocket to any host, so by default only
+// requests from the same origin, or without an Origin header, are upgraded.
+// Use SetCheckOrigin to allow others.
+type WebSocketTx struct {
+	frameStamper
+	mu          sync.Mutex
+	clients     map[*wsClient]struct{}
+	closed      bool
+	queueSize   int
+	dropped     atomic.Uint64
+	timeout     time.Duration
+	checkOrigin func(r *http.Request) bool
+}
+
+func NewWebSocketTx() (s *WebSocketTx) {
+	s = new(WebSocketTx)
+	s.frameStamper = newFrameStamper()
+	s.clients = make(map[*wsClient]struct{})
+	s.queueSize = defaultWebSocketQueue
+	s.timeout = 1 * time.Second
+	s.checkOrigin = sameOrigin
+	return s
+}
+
+// SetCheckOrigin sets the function deciding whether a request may be
+// upgraded, typically by inspecting its Origin header. Passing nil restores
+// the same-origin default.
+func (s *WebSocketTx) SetCheckOrigin(fn func(r *http.Request) bool) {
+	if fn == nil {
+		fn = sameOrigin
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkOrigin = fn
+}
+
+// Allow requests whose origin names the host they were sent to, and those
+// without an Origin header, which come from clients other than browsers.
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+// SetQueueSize sets how many messages may be queued for each client that
+// joins afterwards.
+func (s *WebSocketTx) SetQueueSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queueSize = n
+}
+
+// Clients returns the number of connected clients.
+func (s *WebSocketTx) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Dropped returns the number of messages dropped because a client's queue
+// was full.
+func (s *WebSocketTx) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *WebSocketTx) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key, err := webSocketKey(req)
+	if err != nil {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	closed, queueSize, timeout, checkOrigin := s.closed, s.queueSize, s.timeout, s.checkOrigin
+	s.mu.Unlock()
+	if !checkOrigin(req) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	if closed {
+		http.Error(w, "Stream closed", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n\r\n")
+	client := newWsClient(conn, rw, queueSize, timeout)
+	client.setWriteDeadline()
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		client.close(wsCloseGoingAway)
+	} else {
+		s.clients[client] = struct{}{}
+		s.mu.Unlock()
+	}
+	if debug {
+		log.Printf("WebSocket client %s joined", conn.RemoteAddr())
+	}
+	go client.write()
+	client.read()
+
+	s.mu.Lock()
+	delete(s.clients, client)
+	s.mu.Unlock()
+	if debug {
+		log.Printf("WebSocket client %s left", conn.RemoteAddr())
+	}
+}
+
+// Validate an upgrade request and return its Sec-WebSocket-Key.
+func webSocketKey(req *http.Request) (string, error) {
+	if req.Method != http.MethodGet {
+		return "", fmt.Errorf("WebSocket upgrade requires GET")
+	}
+	if !headerHasToken(req.Header, "Connection", "upgrade") || !headerHasToken(req.Header, "Upgrade", "websocket") {
+		return "", fmt.Errorf("Not a WebSocket upgrade")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		return "", fmt.Errorf("Unsupported WebSocket version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return "", fmt.Errorf("Invalid Sec-WebSocket-Key")
+	}
+	return key, nil
+}
+
+func headerHasToken(h http.Header, name string, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (s *WebSocketTx) WriteFrame(f *Frame) (err error) {
+	return s.WriteFrameContext(context.Background(), f)
+}
+
+// WriteFrameContext queues the frame for every connected client without
+// blocking.
+func (s *WebSocketTx) WriteFrameContext(ctx context.Context, f *Frame) (err error) {
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if len(f.Metadata)+len(f.Data)+webSocketHeaderLength > MAX_FRAME_LENGTH {
+		return fmt.Errorf("Frame larger than max frame length")
+	}
+	message := wsFrame(wsOpBinary, appendWebSocketMessage(nil, f))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		if !client.send(message) {
+			s.dropped.Add(1)
+			if debug {
+				log.Printf("WebSocket queue full for %s, dropping frame %d", client.conn.RemoteAddr(), f.FrameId)
+			}
+		}
+	}
+	return nil
+}
+
+func appendWebSocketMessage(b []byte, f *Frame) []byte {
+	var stamp float64
+	if !f.Timestamp.IsZero() {
+		stamp = float64(f.Timestamp.UnixNano()) / float64(time.Millisecond)
+	}
+	b = binary.BigEndian.AppendUint32(b, f.FrameId)
+	b = binary.BigEndian.AppendUint32(b, f.SessionId)
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(stamp))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(float64(f.Period)/float64(time.Millisecond)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(f.Metadata)))
+	b = append(b, f.Metadata...)
+	return append(b, f.Data...)
+}
+
+func (s *WebSocketTx) Write(metadata []byte, data []byte) (err error) {
+	return s.WriteContext(context.Background(), metadata, data)
+}
+
+func (s *WebSocketTx) WriteContext(ctx context.Context, metadata []byte, data []byte) (err error) {
+	f := s.next(metadata, data)
+	return s.WriteFrameContext(ctx, &f)
+}
+
+// SetTimeout sets how long a write to one client may stall before that
+// client is disconnected, zero for no limit. It applies to clients that
+// connect afterwards.
+func (s *WebSocketTx) SetTimeout(t time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeout = t
+}
+
+// Close disconnects every client with a going away status and rejects new
+// ones. The HTTP server itself is left running.
+func (s *WebSocketTx) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for client := range s.clients {
+		client.close(wsCloseGoingAway)
+	}
+}
+
+// Encode a single unfragmented, unmasked frame as sent by a server.
+func wsFrame(opcode byte, payload []byte) []byte {
+	b := make([]byte, 0, len(payload)+10)
+	b = append(b, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	return append(b, payload...)
+}
+
+// wsClient is one upgraded connection. Messages are written by a single
+// goroutine; the handler goroutine reads control frames from the browser.
+type wsClient struct {
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	timeout time.Duration
+	queue   chan []byte
+	control chan []byte
+	// Closed once the client is disconnected, code is sent as the reason.
+	done chan struct{}
+	once sync.Once
+	code uint16
+}
+
+func newWsClient(conn net.Conn, rw *bufio.ReadWriter, queueSize int, timeout time.Duration) *wsClient {
+	return &wsClient{
+		conn:    conn,
+		rw:      rw,
+		timeout: timeout,
+		queue:   make(chan []byte, queueSize),
+		control: make(chan []byte, 4),
+		done:    make(chan struct{}),
+	}
+}
+
+// Queue a message, reporting false if the queue is full.
+func (c *wsClient) send(message []byte) bool {
+	select {
+	case c.queue <- message:
+		return true
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *wsClient) close(code uint16) {
+	c.once.Do(func() {
+		c.code = code
+		close(c.done)
+	})
+}
+
+func (c *wsClient) setWriteDeadline() {
+	if c.timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+}
+
+func (c *wsClient) write() {
+	defer c.conn.Close()
+	for {
+		var message []byte
+		// Control frames go ahead of queued data.
+		select {
+		case message = <-c.control:
+		default:
+			select {
+			case message = <-c.control:
+			case message = <-c.queue:
+			case <-c.done:
+				c.setWriteDeadline()
+				c.rw.Write(wsFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, c.code)))
+				c.rw.Flush()
+				return
+			}
+		}
+		c.setWriteDeadline()
+		c.rw.Write(message)
+		if err := c.rw.Flush(); err != nil {
+			if debug {
+				log.Printf("WebSocket write to %s failed: %v", c.conn.RemoteAddr(), err)
+			}
+			c.close(wsCloseGoingAway)
+			return
+		}
+	}
+}
+
+// Read frames from the browser until it goes away. Pings are answered and
+// data messages are discarded.
+func (c *wsClient) read() {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			code := uint16(wsCloseGoingAway)
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				code = wsCloseProtocol
+				if debug {
+					log.Printf("WebSocket read from %s failed: %v", c.conn.RemoteAddr(), err)
+				}
+			}
+			c.close(code)
+			return
+		}
+		switch opcode {
+		case wsOpPing:
+			select {
+			case c.control <- wsFrame(wsOpPong, payload):
+			default:
+			}
+		case wsOpClose:
+			c.close(wsCloseNormal)
+			return
+		}
+	}
+}
+
+// Read one client frame. Clients must mask their frames, and frames longer
+// than wsMaxClientFrame end the connection.
+func (c *wsClient) readFrame() (opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.rw, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode = header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("Unmasked client frame")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.rw, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.rw, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(b[:])
+	}
+	if opcode >= wsOpClose && length > wsMaxControlFrame {
+		return 0, nil, fmt.Errorf("Control frame too long")
+	}
+	if length > wsMaxClientFrame {
+		c.close(wsCloseTooBig)
+		return 0, nil, fmt.Errorf("Client frame too long")
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.rw, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,226 @@
+package streamcast
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A minimal WebSocket client, reading the server's unmasked frames.
+type wsTestClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server) *wsTestClient {
+	t.Helper()
+	conn, reader, resp := upgradeWebSocket(t, server, "")
+	// The example handshake from RFC 6455.
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Upgrade failed: %s %v", resp.Status, resp.Header)
+	}
+	return &wsTestClient{conn: conn, reader: reader}
+}
+
+// Send an upgrade request, with an Origin header unless origin is empty.
+func upgradeWebSocket(t *testing.T, server *httptest.Server, origin string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	request := "GET /stream HTTP/1.1\r\nHost: localhost\r\n" +
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	if origin != "" {
+		request += "Origin: " + origin + "\r\n"
+	}
+	io.WriteString(conn, request+"\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, resp
+}
+
+func (c *wsTestClient) send(t *testing.T, opcode byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	b := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	b = append(b, mask[:]...)
+	for i, v := range payload {
+		b = append(b, v^mask[i%4])
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *wsTestClient) receive(t *testing.T) (opcode byte, payload []byte) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1])
+	if length == 126 {
+		var b [2]byte
+		io.ReadFull(c.reader, b[:])
+		length = int(binary.BigEndian.Uint16(b[:]))
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func waitForClients(t *testing.T, tx *WebSocketTx, n int) {
+	t.Helper()
+	for start := time.Now(); tx.Clients() != n; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("%d clients, expected %d", tx.Clients(), n)
+		}
+	}
+}
+
+func TestWebSocketTx(t *testing.T) {
+	tx := NewWebSocketTx()
+	tx.SetSessionId(7)
+	tx.SetNominalPeriod(20 * time.Millisecond)
+	server := httptest.NewServer(tx)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Plain request got %s", resp.Status)
+	}
+
+	clients := []*wsTestClient{dialWebSocket(t, server), dialWebSocket(t, server)}
+	waitForClients(t, tx, 2)
+
+	stamp := time.UnixMilli(1700000000123)
+	f := Frame{FrameId: 42, Metadata: []byte("meta"), Data: []byte("data"), Timestamp: stamp}
+	if err = tx.WriteFrame(&f); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Write(nil, []byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range clients {
+		opcode, m := c.receive(t)
+		if opcode != wsOpBinary || len(m) != webSocketHeaderLength+8 {
+			t.Fatalf("Received opcode %d, %d bytes", opcode, len(m))
+		}
+		if binary.BigEndian.Uint32(m[0:]) != 42 ||
+			math.Float64frombits(binary.BigEndian.Uint64(m[8:])) != 1700000000123 ||
+			binary.BigEndian.Uint32(m[24:]) != 4 || string(m[28:]) != "metadata" {
+			t.Fatalf("Unexpected message % x", m)
+		}
+		_, m = c.receive(t)
+		if binary.BigEndian.Uint32(m[0:]) != 1 || binary.BigEndian.Uint32(m[4:]) != 7 ||
+			math.Float64frombits(binary.BigEndian.Uint64(m[16:])) != 20 || string(m[28:]) != "next" {
+			t.Fatalf("Unexpected message % x", m)
+		}
+	}
+
+	clients[0].send(t, wsOpPing, []byte("hi"))
+	if opcode, m := clients[0].receive(t); opcode != wsOpPong || string(m) != "hi" {
+		t.Fatalf("Ping answered with opcode %d %q", opcode, m)
+	}
+
+	// A client saying goodbye is answered and removed.
+	clients[0].send(t, wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+	if opcode, _ := clients[0].receive(t); opcode != wsOpClose {
+		t.Fatalf("Close answered with opcode %d", opcode)
+	}
+	waitForClients(t, tx, 1)
+
+	tx.Close()
+	if opcode, m := clients[1].receive(t); opcode != wsOpClose || binary.BigEndian.Uint16(m) != wsCloseGoingAway {
+		t.Fatalf("Expected going away, got opcode %d % x", opcode, m)
+	}
+	waitForClients(t, tx, 0)
+	resp, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Plain request after close got %s", resp.Status)
+	}
+}
+
+func TestWebSocketNoTimeout(t *testing.T) {
+	tx := NewWebSocketTx()
+	tx.SetTimeout(0)
+	defer tx.Close()
+	server := httptest.NewServer(tx)
+	defer server.Close()
+
+	client := dialWebSocket(t, server)
+	waitForClients(t, tx, 1)
+	if err := tx.Write(nil, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if opcode, m := client.receive(t); opcode != wsOpBinary || string(m[webSocketHeaderLength:]) != "data" {
+		t.Fatalf("Received opcode %d % x", opcode, m)
+	}
+}
+
+func TestWebSocketQueueFull(t *testing.T) {
+	client := newWsClient(nil, nil, 2, time.Second)
+	tx := NewWebSocketTx()
+	tx.clients[client] = struct{}{}
+	for i := 0; i < 5; i++ {
+		if err := tx.Write(nil, []byte(strings.Repeat("x", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tx.Dropped() != 3 || len(client.queue) != 2 {
+		t.Fatalf("Dropped %d with %d queued", tx.Dropped(), len(client.queue))
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	tx := NewWebSocketTx()
+	defer tx.Close()
+	server := httptest.NewServer(tx)
+	defer server.Close()
+
+	for origin, status := range map[string]int{
+		"http://localhost":       http.StatusSwitchingProtocols,
+		"https://LOCALHOST":      http.StatusSwitchingProtocols,
+		"http://evil.example":    http.StatusForbidden,
+		"http://localhost:8080":  http.StatusForbidden,
+		"http://localhost.other": http.StatusForbidden,
+	} {
+		if _, _, resp := upgradeWebSocket(t, server, origin); resp.StatusCode != status {
+			t.Errorf("Origin %s: %s, expected %d", origin, resp.Status, status)
+		}
+	}
+
+	tx.SetCheckOrigin(func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "http://evil.example"
+	})
+	if _, _, resp := upgradeWebSocket(t, server, "http://evil.example"); resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Allowed origin rejected: %s", resp.Status)
+	}
+	if _, _, resp := upgradeWebSocket(t, server, "http://localhost"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Disallowed origin upgraded: %s", resp.Status)
+	}
+}